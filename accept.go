@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const diffSignatureLength = 12
+
+// An actual file from the last run which would be accepted as the corrected
+// golden value for its file ID.
+type acceptCandidate struct {
+	fileID    string
+	signature string
+	testEAD   string
+}
+
+// The targets of an `accept`: test EADs of the form [repository code]/[EAD ID],
+// file IDs, and diff signatures.  A candidate matches if it matches any of them.
+type acceptTargets struct {
+	fileIDs    []string
+	signatures []string
+	testEADs   []string
+}
+
+func (targets acceptTargets) isEmpty() bool {
+	return len(targets.fileIDs) == 0 && len(targets.signatures) == 0 && len(targets.testEADs) == 0
+}
+
+func (targets acceptTargets) matches(candidate acceptCandidate) bool {
+	return slices.Contains(targets.testEADs, candidate.testEAD) ||
+		slices.Contains(targets.fileIDs, candidate.fileID) ||
+		slices.Contains(targets.signatures, candidate.signature)
+}
+
+// Describes each target which matches none of the candidates, which is most
+// likely a typo, or a diff which went away in the last run.
+func (targets acceptTargets) unmatched(candidates []acceptCandidate) []string {
+	unmatched := []string{}
+	for _, target := range []struct {
+		kind   string
+		values []string
+		value  func(acceptCandidate) string
+	}{
+		{"test EAD", targets.testEADs, func(candidate acceptCandidate) string { return candidate.testEAD }},
+		{"file ID", targets.fileIDs, func(candidate acceptCandidate) string { return candidate.fileID }},
+		{"diff signature", targets.signatures, func(candidate acceptCandidate) string { return candidate.signature }},
+	} {
+		for _, value := range target.values {
+			if !slices.ContainsFunc(candidates, func(candidate acceptCandidate) bool {
+				return target.value(candidate) == value
+			}) {
+				unmatched = append(unmatched, fmt.Sprintf(`%s "%s"`, target.kind, value))
+			}
+		}
+	}
+
+	return unmatched
+}
+
+// Builds the overlay files for all candidates before writing any of them, so
+// that a bad candidate doesn't leave a partial accept behind.
+func acceptCandidates(candidates []acceptCandidate, reason string, ticket string) ([]goldenOverlay, error) {
+	overlays := []goldenOverlay{}
+	overlayCaptures := [][]byte{}
+
+	for _, candidate := range candidates {
+		actualValue, err := os.ReadFile(tmpFile(candidate.testEAD, candidate.fileID))
+		if err != nil {
+			return nil, err
+		}
+
+		relativePath := filepath.Join(candidate.testEAD, candidate.fileID+goldenFileSuffix)
+		upstreamCapture, err := os.ReadFile(filepath.Join(goldenFilesDirPath, relativePath))
+		if err != nil {
+			return nil, err
+		}
+
+		overlay := goldenOverlay{
+			File:     relativePath,
+			Reason:   reason,
+			Replaces: relativePath,
+			Ticket:   ticket,
+		}
+		overlayCapture, err := buildOverlayCapture(upstreamCapture, string(actualValue), overlay)
+		if err != nil {
+			return nil, fmt.Errorf("golden file %s: %s", relativePath, err)
+		}
+		// The overlay file must be usable, or the next run would report a golden
+		// file error instead of the mismatch which was accepted.
+		request, err := parseGoldenRequest(overlayCapture)
+		if err == nil {
+			_, err = parseGoldenOverlay(candidate.testEAD, candidate.fileID, request.header)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("overlay file for %s would be invalid: %s", relativePath, err)
+		}
+
+		overlays = append(overlays, overlay)
+		overlayCaptures = append(overlayCaptures, overlayCapture)
+	}
+
+	for i, overlay := range overlays {
+		overlayFile := filepath.Join(overlayDirPath, overlay.File)
+		err := os.MkdirAll(filepath.Dir(overlayFile), 0755)
+		if err != nil {
+			return overlays[:i], err
+		}
+		err = os.WriteFile(overlayFile, overlayCaptures[i], 0644)
+		if err != nil {
+			return overlays[:i], err
+		}
+	}
+
+	return overlays, nil
+}
+
+// Wraps the accepted value in the HTTP request envelope of the upstream golden
+// file, so that the overlay file looks like the capture the v1 indexer should
+// have sent.  The Content-Length header is updated for the new body, and the
+// overlay metadata headers are added after the original headers.
+func buildOverlayCapture(upstreamCapture []byte, body string, overlay goldenOverlay) ([]byte, error) {
+	lineEnding := "\r\n"
+	headerEnd := bytes.Index(upstreamCapture, []byte(lineEnding+lineEnding))
+	if headerEnd < 0 {
+		lineEnding = "\n"
+		headerEnd = bytes.Index(upstreamCapture, []byte(lineEnding+lineEnding))
+	}
+	if headerEnd < 0 {
+		return nil, errors.New("no end of headers")
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(upstreamCapture[:headerEnd]), lineEnding) {
+		name, _, _ := strings.Cut(line, ":")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "content-length":
+			line = "Content-Length: " + strconv.Itoa(len(body))
+		case strings.ToLower(overlayReasonHeader), strings.ToLower(overlayReplacesHeader),
+			strings.ToLower(overlayTicketHeader):
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines,
+		overlayReplacesHeader+": "+overlay.Replaces,
+		overlayReasonHeader+": "+overlay.Reason,
+		overlayTicketHeader+": "+overlay.Ticket)
+
+	return []byte(strings.Join(lines, lineEnding) + lineEnding + lineEnding + body), nil
+}
+
+// The actual file of a candidate is stale if any of the inputs of its EAD have
+// changed since the last run, in which case a new run could generate a
+// different actual value or diff.  An EAD which is not in the cache of the last
+// run is treated as stale too, because we can't tell.
+func checkActualFileIsCurrent(testEAD string, cache map[string]eadResult) error {
+	cachedResult, ok := cache[testEAD]
+	if !ok {
+		return errors.New("not in the results of the last run")
+	}
+
+	inputs, err := getInputHashes(testEAD)
+	if err != nil {
+		return err
+	}
+	changedInputs := getChangedInputs(cachedResult.Inputs, inputs)
+	if len(changedInputs) > 0 {
+		return fmt.Errorf("changed since the last run: %s", strings.Join(changedInputs, ", "))
+	}
+
+	return nil
+}
+
+// Returns a candidate for every actual file in the output directory, in test EAD
+// and file ID order.
+func getAcceptCandidates() ([]acceptCandidate, error) {
+	candidates := []acceptCandidate{}
+
+	err := filepath.WalkDir(tmpFilesDirPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() || !strings.HasSuffix(path, actualFileSuffix) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(tmpFilesDirPath, path)
+		if err != nil {
+			return err
+		}
+		candidate := acceptCandidate{
+			fileID:  strings.TrimSuffix(filepath.Base(relativePath), actualFileSuffix),
+			testEAD: filepath.ToSlash(filepath.Dir(relativePath)),
+		}
+
+		diff, err := os.ReadFile(diffFile(candidate.testEAD, candidate.fileID))
+		if err != nil {
+			return err
+		}
+		candidate.signature = getDiffSignature(string(diff))
+		candidates = append(candidates, candidate)
+
+		return nil
+	})
+	if err != nil {
+		return candidates, err
+	}
+
+	slices.SortFunc(candidates, func(a acceptCandidate, b acceptCandidate) int {
+		return cmp.Or(strings.Compare(a.testEAD, b.testEAD), strings.Compare(a.fileID, b.fileID))
+	})
+
+	return candidates, nil
+}
+
+// The signature identifies the changes in a diff regardless of where they are,
+// so that the same v1 indexer bug can be accepted for every file it affects at
+// once.  It is a hash of the added and removed lines of the diff, without the
+// file headers and hunk positions.  Only the lines before the first hunk are
+// headers: a changed line whose value starts with "--" or "++" is a "---" or
+// "+++" line in a hunk.
+func getDiffSignature(diff string) string {
+	hash := sha256.New()
+	inHunks := false
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			inHunks = true
+			continue
+		}
+		if inHunks && (strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+")) {
+			fmt.Fprintln(hash, line)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:diffSignatureLength]
+}
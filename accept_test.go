@@ -0,0 +1,314 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuildOverlayCapture(t *testing.T) {
+	const body = `<?xml version="1.0" encoding="UTF-8"?><add><doc><field name="id">tiny_001</field></doc></add>`
+	overlay := goldenOverlay{
+		File:     "test/tiny_001/tiny_001-add.txt",
+		Reason:   "v1 bug",
+		Replaces: "test/tiny_001/tiny_001-add.txt",
+		Ticket:   "DLFA-0",
+	}
+
+	testCases := []struct {
+		name          string
+		capture       string
+		expectedError string
+	}{
+		{
+			name:    "CRLF line endings",
+			capture: makeTestGoldenCapture("POST /solr/findingaids/update?wt=ruby HTTP/1.1", "text/xml; charset=utf-8", len(testGoldenBody), testGoldenBody),
+		},
+		{
+			name: "LF line endings",
+			capture: strings.ReplaceAll(makeTestGoldenCapture("POST /solr/findingaids/update?wt=ruby HTTP/1.1",
+				"text/xml; charset=utf-8", len(testGoldenBody), testGoldenBody), "\r\n", "\n"),
+		},
+		{
+			name: "overlay of an overlay",
+			capture: strings.Replace(makeTestGoldenCapture("POST /solr/findingaids/update?wt=ruby HTTP/1.1",
+				"text/xml; charset=utf-8", len(testGoldenBody), testGoldenBody), "\r\n",
+				"\r\n"+overlayReasonHeader+": old reason\r\n"+overlayTicketHeader+": DLFA-1\r\n", 1),
+		},
+		{
+			name:          "no end of headers",
+			capture:       "POST /solr/findingaids/update?wt=ruby HTTP/1.1\r\nContent-Length: 0\r\n",
+			expectedError: "no end of headers",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			capture, err := buildOverlayCapture([]byte(testCase.capture), body, overlay)
+			if testCase.expectedError != "" {
+				if err == nil || err.Error() != testCase.expectedError {
+					t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildOverlayCapture() failed: %s", err)
+			}
+
+			// The Content-Length is rewritten for the new body, which is longer,
+			// so `parseGoldenRequest` would fail on the old one.
+			request, err := parseGoldenRequest(capture)
+			if err != nil {
+				t.Fatalf("parseGoldenRequest() of the overlay capture failed: %s", err)
+			}
+			if request.body != body {
+				t.Errorf("expected body %q, got %q", body, request.body)
+			}
+			if contentLength := request.header.Get("Content-Length"); contentLength != strconv.Itoa(len(body)) {
+				t.Errorf("expected Content-Length %d, got %s", len(body), contentLength)
+			}
+			if request.header.Get("User-Agent") != "Ruby" {
+				t.Errorf("expected the other headers of the upstream capture to be kept, got %v", request.header)
+			}
+			for _, name := range []string{overlayReasonHeader, overlayReplacesHeader, overlayTicketHeader} {
+				if values := request.header.Values(name); len(values) != 1 {
+					t.Errorf("expected one %s header, got %q", name, values)
+				}
+			}
+			parsedOverlay := goldenOverlay{
+				File:     overlay.File,
+				Reason:   request.header.Get(overlayReasonHeader),
+				Replaces: request.header.Get(overlayReplacesHeader),
+				Ticket:   request.header.Get(overlayTicketHeader),
+			}
+			if parsedOverlay != overlay {
+				t.Errorf("expected the overlay metadata %+v, got %+v", overlay, parsedOverlay)
+			}
+		})
+	}
+}
+
+// The overlay files written by `acceptCandidates` can be parsed back, and make
+// the mismatches that were accepted pass.
+func TestAcceptCandidates(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	breakGoldenFile(t, testEAD, testdataMismatchFileID)
+	if output := testSingleEAD(testEAD); output.result.Status != statusFailed {
+		t.Fatalf("expected status %q, got %q: %s", statusFailed, output.result.Status, output.stderr.String())
+	}
+
+	candidates, err := getAcceptCandidates()
+	if err != nil {
+		t.Fatalf("getAcceptCandidates() failed: %s", err)
+	}
+	if len(candidates) != 1 || candidates[0].fileID != testdataMismatchFileID {
+		t.Fatalf("expected a candidate for %s, got %+v", testdataMismatchFileID, candidates)
+	}
+	actualValue, err := os.ReadFile(tmpFile(testEAD, testdataMismatchFileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overlays, err := acceptCandidates(candidates, "v1 bug", "DLFA-0")
+	if err != nil {
+		t.Fatalf("acceptCandidates() failed: %s", err)
+	}
+
+	capture, err := os.ReadFile(getOverlayFilePath(testEAD, testdataMismatchFileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := parseGoldenRequest(capture)
+	if err != nil {
+		t.Fatalf("parseGoldenRequest() of the overlay file failed: %s", err)
+	}
+	if request.body != string(actualValue) {
+		t.Errorf("expected the actual value as the body, got %q", request.body)
+	}
+	overlay, err := parseGoldenOverlay(testEAD, testdataMismatchFileID, request.header)
+	if err != nil {
+		t.Fatalf("parseGoldenOverlay() of the overlay file failed: %s", err)
+	}
+	if len(overlays) != 1 || overlay != overlays[0] {
+		t.Errorf("expected %+v, got %+v", overlays, overlay)
+	}
+
+	if output := testSingleEAD(testEAD); output.result.Status != statusPassed {
+		t.Errorf("expected status %q with the overlay, got %q: %s", statusPassed, output.result.Status,
+			output.stderr.String())
+	}
+}
+
+func TestCheckActualFileIsCurrent(t *testing.T) {
+	testCases := []struct {
+		name          string
+		change        func(t *testing.T, testEAD string, cache map[string]eadResult)
+		expectedError string
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {},
+		},
+		{
+			name: "not in the last run",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				delete(cache, testEAD)
+			},
+			expectedError: "not in the results of the last run",
+		},
+		{
+			name: "EAD",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				appendToFile(t, getEADFilePath(testEAD), "\n")
+			},
+			expectedError: "changed since the last run: EAD",
+		},
+		{
+			name: "golden file",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				breakGoldenFile(t, testEAD, testdataMismatchFileID)
+			},
+			expectedError: "changed since the last run: golden files",
+		},
+		{
+			name: "go-ead-indexer",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				indexerVersion = "other"
+			},
+			expectedError: "changed since the last run: go-ead-indexer version (test => other)",
+		},
+		{
+			name: "massage rules",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				massageRulesHash = "other"
+			},
+			expectedError: "changed since the last run: massage rules",
+		},
+		{
+			name: "comparison",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				setComparisonMode(comparisonExact)
+			},
+			expectedError: "changed since the last run: comparison (",
+		},
+		{
+			name: "component filters and massage rules",
+			change: func(t *testing.T, testEAD string, cache map[string]eadResult) {
+				setFilters(filters{ExcludeComponents: []string{"ref3$"}})
+				massageRulesHash = "other"
+			},
+			expectedError: "changed since the last run: component filters, massage rules",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+			inputs, err := getInputHashes(testEAD)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache := map[string]eadResult{testEAD: {Inputs: inputs, Status: statusFailed, TestEAD: testEAD}}
+
+			testCase.change(t, testEAD, cache)
+			err = checkActualFileIsCurrent(testEAD, cache)
+			if testCase.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected current, got %s", err)
+				}
+			} else if err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+				t.Errorf("expected error starting with %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestGetDiffSignature(t *testing.T) {
+	diff := "--- golden\n+++ actual\n@@ -1,3 +1,3 @@\n a\n-b\n+c\n d\n"
+	moved := "--- other golden\n+++ other actual\n@@ -10,3 +10,3 @@\n x\n-b\n+c\n y\n"
+	different := "--- golden\n+++ actual\n@@ -1,3 +1,3 @@\n a\n-b\n+e\n d\n"
+	// Changed lines which look like file headers.
+	dashes := "--- golden\n+++ actual\n@@ -1,3 +1,3 @@\n a\n---b\n+++c\n d\n"
+	otherDashes := "--- golden\n+++ actual\n@@ -1,3 +1,3 @@\n a\n---b\n+++e\n d\n"
+
+	signature := getDiffSignature(diff)
+	if len(signature) != diffSignatureLength {
+		t.Errorf("expected a signature of length %d, got %q", diffSignatureLength, signature)
+	}
+	if movedSignature := getDiffSignature(moved); movedSignature != signature {
+		t.Errorf("expected the same changes elsewhere to have signature %q, got %q", signature, movedSignature)
+	}
+	if differentSignature := getDiffSignature(different); differentSignature == signature {
+		t.Errorf("expected different changes to have a different signature than %q", signature)
+	}
+	if getDiffSignature(dashes) == getDiffSignature(otherDashes) {
+		t.Errorf("expected different changed lines starting with \"---\" and \"+++\" to have different signatures")
+	}
+}
+
+// `accept` writes nothing if a target doesn't match, or if the run is stale.
+func TestCmdAcceptRefusals(t *testing.T) {
+	testCases := []struct {
+		name           string
+		change         func(t *testing.T, testEAD string)
+		args           []string
+		expectedStderr string
+	}{
+		{
+			name:           "diff signature mismatch",
+			change:         func(t *testing.T, testEAD string) {},
+			args:           []string{"-signature", "000000000000"},
+			expectedStderr: `No actual values to accept for diff signature "000000000000"`,
+		},
+		{
+			name:           "one of the targets doesn't match",
+			change:         func(t *testing.T, testEAD string) {},
+			args:           []string{"test/tiny_001", "tiny_001aspace_ref9"},
+			expectedStderr: `No actual values to accept for file ID "tiny_001aspace_ref9"`,
+		},
+		{
+			name: "stale actual values",
+			change: func(t *testing.T, testEAD string) {
+				appendToFile(t, getEADFilePath(testEAD), "\n")
+			},
+			args:           []string{"test/tiny_001"},
+			expectedStderr: "Actual values for test/tiny_001 are stale: changed since the last run: EAD\n",
+		},
+		{
+			name:   "different component filters",
+			change: func(t *testing.T, testEAD string) {},
+			args:   []string{"-exclude-component", "ref1$", "test/tiny_001"},
+			expectedStderr: "Actual values for test/tiny_001 are stale: changed since the last run: " +
+				"component filters\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+			breakGoldenFile(t, testEAD, testdataMismatchFileID)
+			flags := []string{"-ead-root", eadDirPath, "-golden-root", goldenFilesDirPath,
+				"-overlay-root", overlayDirPath, "-output", outputDirPath}
+			exitStatus, _, stderr := runCommand(t, slices.Concat([]string{"run"}, flags)...)
+			if exitStatus != exitFailure {
+				t.Fatalf("expected the run to fail, got exit status %d: %s", exitStatus, stderr)
+			}
+
+			testCase.change(t, testEAD)
+			exitStatus, stdout, stderr := runCommand(t, slices.Concat(
+				[]string{"accept", "-reason", "v1 bug", "-ticket", "DLFA-0"}, flags, testCase.args)...)
+			if exitStatus != exitFailure {
+				t.Errorf("expected exit status %d, got %d\nstdout: %s\nstderr: %s", exitFailure, exitStatus,
+					stdout, stderr)
+			}
+			if !strings.Contains(stderr, testCase.expectedStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", testCase.expectedStderr, stderr)
+			}
+			if _, err := os.Stat(getOverlayFilePath(testEAD, testdataMismatchFileID)); err == nil {
+				t.Errorf("expected no overlay file to be written")
+			}
+		})
+	}
+}
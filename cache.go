@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const cacheFileName = "cache.json"
+const indexerModulePath = "github.com/nyulibraries/go-ead-indexer"
+
+// Hashes of everything that can change the result of testing an EAD.  If all
+// of these are the same as in the previous run, an incremental run does not
+// need to test the EAD again.
+type inputHashes struct {
+	// The comparison mode and field semantics, which are short enough not to
+	// need hashing.  See `getComparisonDescription`.
+	Comparison       string `json:"comparison"`
+	ComponentFilters string `json:"component_filters,omitempty"`
+	// See `getDiffDescription`.
+	Diff           string `json:"diff,omitempty"`
+	EAD            string `json:"ead"`
+	GoldenFiles    string `json:"golden_files"`
+	IndexerVersion string `json:"indexer_version"`
+	MassageRules   string `json:"massage_rules"`
+}
+
+// Results from the previous run, keyed by test EAD.  Only populated in
+// incremental mode.
+var cachedResults = map[string]eadResult{}
+
+// These are the same for every test EAD, so we only compute them once per run.
+var indexerVersion string
+var massageRulesHash string
+
+func cacheFile() string {
+	return filepath.Join(outputDirPath, "tmp", cacheFileName)
+}
+
+// Describes the inputs which differ between `before` and `after`.  The ones
+// which aren't hashed are shown with their values.
+func getChangedInputs(before inputHashes, after inputHashes) []string {
+	changedInputs := []string{}
+	for _, input := range []struct {
+		name          string
+		before, after string
+		showValues    bool
+	}{
+		{"comparison", before.Comparison, after.Comparison, true},
+		{"component filters", before.ComponentFilters, after.ComponentFilters, false},
+		{"diff options", before.Diff, after.Diff, true},
+		{"EAD", before.EAD, after.EAD, false},
+		{"golden files", before.GoldenFiles, after.GoldenFiles, false},
+		{"go-ead-indexer version", before.IndexerVersion, after.IndexerVersion, true},
+		{"massage rules", before.MassageRules, after.MassageRules, false},
+	} {
+		if input.before == input.after {
+			continue
+		}
+		if input.showValues {
+			changedInputs = append(changedInputs,
+				fmt.Sprintf("%s (%s => %s)", input.name, input.before, input.after))
+		} else {
+			changedInputs = append(changedInputs, input.name)
+		}
+	}
+
+	return changedInputs
+}
+
+// Returns the go-ead-indexer version required by go.mod.  If there is a
+// `replace` directive for the module, its target is included as well, but note
+// that for a local directory replacement we can't detect changes made to the
+// contents of that directory.
+func getIndexerVersion() (string, error) {
+	goModFile, err := os.Open(filepath.Join(rootPath, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	defer goModFile.Close()
+
+	requireVersion := ""
+	replaceTarget := ""
+	scanner := bufio.NewScanner(goModFile)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+
+		if fields[0] == "require" || fields[0] == "replace" {
+			fields = fields[1:]
+		}
+		if len(fields) >= 2 && fields[0] == indexerModulePath {
+			if arrowIndex := slices.Index(fields, "=>"); arrowIndex >= 0 {
+				replaceTarget = strings.Join(fields[arrowIndex+1:], " ")
+			} else {
+				requireVersion = fields[1]
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if requireVersion == "" {
+		return "", fmt.Errorf("no require directive for %s found in go.mod", indexerModulePath)
+	}
+
+	if replaceTarget != "" {
+		return requireVersion + " => " + replaceTarget, nil
+	}
+
+	return requireVersion, nil
+}
+
+func getInputHashes(testEAD string) (inputHashes, error) {
+	eadHash, err := hashFile(getEADFilePath(testEAD))
+	if err != nil {
+		return inputHashes{}, err
+	}
+
+	goldenFilesHash, err := hashGoldenFiles(testEAD)
+	if err != nil {
+		return inputHashes{}, err
+	}
+
+	return inputHashes{
+		Comparison:       getComparisonDescription(),
+		ComponentFilters: componentFiltersHash,
+		Diff:             getDiffDescription(),
+		EAD:              eadHash,
+		GoldenFiles:      goldenFilesHash,
+		IndexerVersion:   indexerVersion,
+		MassageRules:     massageRulesHash,
+	}, nil
+}
+
+// Covers the code of the builtin massages, the massage rules file, the golden
+// fixes, and the rules enabled by the config.
+func getMassageRulesHash() (string, error) {
+	hash := sha256.New()
+
+	for _, file := range []string{filepath.Join(rootPath, massageRulesSourceFile), massageRulesFilePath,
+		filepath.Join(rootPath, goldenFixesSourceFile)} {
+		fileHash, err := hashFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s %s\n", filepath.Base(file), fileHash)
+	}
+
+	// `os.ReadDir` returns the entries sorted by file name, so the hash is
+	// stable.
+	dirEntries, err := os.ReadDir(goldenFixesDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		fileHash, err := hashFile(filepath.Join(goldenFixesDir(), dirEntry.Name()))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s/%s %s\n", goldenFixesDirName, dirEntry.Name(), fileHash)
+	}
+
+	fmt.Fprintf(hash, "%s\n", strings.Join(getMassageRuleNames(enabledMassageRules), ","))
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Hashes the names and contents of all golden files for the test EAD, including
+// the ones we don't currently test against, like the commit requests, and of
+// its overlay files, if it has any.
+func hashGoldenFiles(testEAD string) (string, error) {
+	hash := sha256.New()
+
+	for _, filesDir := range []struct{ path, prefix string }{
+		{filepath.Join(goldenFilesDirPath, testEAD), ""},
+		{filepath.Join(overlayDirPath, testEAD), "overlay/"},
+	} {
+		// `filepath.WalkDir` walks in lexical order, so the hash is stable.
+		err := filepath.WalkDir(filesDir.path,
+			func(path string, dirEntry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if dirEntry.IsDir() {
+					return nil
+				}
+
+				fileHash, err := hashFile(path)
+				if err != nil {
+					return err
+				}
+				relativePath, err := filepath.Rel(filesDir.path, path)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(hash, "%s%s %s\n", filesDir.prefix, relativePath, fileHash)
+
+				return nil
+			})
+		// Most EADs have no overlay files.
+		if err != nil && !(filesDir.prefix != "" && errors.Is(err, os.ErrNotExist)) {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// A missing cache file is not an error: it just means that every EAD will be
+// tested.
+func readCache() (map[string]eadResult, error) {
+	cache := map[string]eadResult{}
+
+	bytes, err := os.ReadFile(cacheFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cache, nil
+		}
+		return cache, err
+	}
+
+	err = json.Unmarshal(bytes, &cache)
+
+	return cache, err
+}
+
+// Deletes the crash, diff, and tmp actual files from a previous test of the EAD,
+// which would otherwise be left behind if the EAD now passes, or if a component
+// no longer fails.
+func removeEADOutputs(testEAD string) error {
+	err := os.RemoveAll(crashFile(testEAD))
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(filepath.Join(diffsDirPath, testEAD))
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(tmpFilesDirPath, testEAD))
+}
+
+// Write to a temp file and then rename it, so that a run that dies while
+// writing the cache doesn't leave a truncated cache file behind.
+func writeCache(cache map[string]eadResult) error {
+	bytes, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(cacheFile()), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpCacheFile := cacheFile() + ".tmp"
+	err = os.WriteFile(tmpCacheFile, bytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpCacheFile, cacheFile())
+}
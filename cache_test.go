@@ -0,0 +1,211 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetIndexerVersion(t *testing.T) {
+	version, err := getIndexerVersion()
+	if err != nil {
+		t.Fatalf("getIndexerVersion() failed: %s", err)
+	}
+	if !strings.HasPrefix(version, "v") {
+		t.Errorf(`expected a version starting with "v", got %q`, version)
+	}
+}
+
+func TestGetInputHashes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		change        func(t *testing.T, testEAD string)
+		expectChanged func(before inputHashes, after inputHashes) bool
+	}{
+		{
+			name:   "nothing changed",
+			change: func(t *testing.T, testEAD string) {},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return false
+			},
+		},
+		{
+			name: "EAD",
+			change: func(t *testing.T, testEAD string) {
+				appendToFile(t, getEADFilePath(testEAD), "\n")
+			},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return before.EAD != after.EAD
+			},
+		},
+		{
+			name: "golden file",
+			change: func(t *testing.T, testEAD string) {
+				breakGoldenFile(t, testEAD, testdataMismatchFileID)
+			},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return before.GoldenFiles != after.GoldenFiles
+			},
+		},
+		{
+			name: "overlay file",
+			change: func(t *testing.T, testEAD string) {
+				copyTestdataFile(t, getGoldenFilePath(testEAD, testdataMismatchFileID),
+					getOverlayFilePath(testEAD, testdataMismatchFileID))
+			},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return before.GoldenFiles != after.GoldenFiles
+			},
+		},
+		{
+			name: "comparison mode",
+			change: func(t *testing.T, testEAD string) {
+				setComparisonMode(comparisonExact)
+			},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return before.Comparison != after.Comparison
+			},
+		},
+		{
+			name: "component filters",
+			change: func(t *testing.T, testEAD string) {
+				setFilters(filters{ExcludeComponents: []string{"ref3$"}})
+			},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return before.ComponentFilters != after.ComponentFilters
+			},
+		},
+		{
+			name: "EAD filters",
+			change: func(t *testing.T, testEAD string) {
+				setFilters(filters{IncludeEADs: []string{"tiny_*"}})
+			},
+			expectChanged: func(before inputHashes, after inputHashes) bool {
+				return false
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+
+			before, err := getInputHashes(testEAD)
+			if err != nil {
+				t.Fatalf("getInputHashes() failed: %s", err)
+			}
+			testCase.change(t, testEAD)
+			after, err := getInputHashes(testEAD)
+			if err != nil {
+				t.Fatalf("getInputHashes() after the change failed: %s", err)
+			}
+
+			expectChanged := testCase.expectChanged(before, after)
+			if changed := before != after; changed != expectChanged {
+				t.Errorf("expected changed inputs: %t, got before %+v, after %+v", expectChanged, before, after)
+			}
+		})
+	}
+}
+
+func TestReadCache(t *testing.T) {
+	setUpTestRun(t, 0)
+
+	cache, err := readCache()
+	if err != nil {
+		t.Fatalf("readCache() without a cache file failed: %s", err)
+	}
+	if len(cache) != 0 {
+		t.Errorf("expected an empty cache, got %v", cache)
+	}
+
+	expected := map[string]eadResult{
+		testdataEAD: {
+			Counts:  eadCounts{ComponentsTested: 3, Matched: 4},
+			Inputs:  inputHashes{EAD: "ead", GoldenFiles: "golden", IndexerVersion: "test"},
+			Status:  statusPassed,
+			TestEAD: testdataEAD,
+		},
+	}
+	err = writeCache(expected)
+	if err != nil {
+		t.Fatalf("writeCache() failed: %s", err)
+	}
+	cache, err = readCache()
+	if err != nil {
+		t.Fatalf("readCache() failed: %s", err)
+	}
+	if !reflect.DeepEqual(cache, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cache)
+	}
+	if _, err = os.Stat(cacheFile() + ".tmp"); err == nil {
+		t.Errorf("writeCache() left its temp file behind")
+	}
+}
+
+// In incremental mode, an EAD is only tested again if its inputs changed, or if
+// it timed out last time.
+func TestTestEADIfNeededIncremental(t *testing.T) {
+	testCases := []struct {
+		name           string
+		change         func(t *testing.T, testEAD string, cachedResult *eadResult)
+		expectedTested bool
+	}{
+		{
+			name:           "unchanged",
+			change:         func(t *testing.T, testEAD string, cachedResult *eadResult) {},
+			expectedTested: false,
+		},
+		{
+			name: "golden file changed",
+			change: func(t *testing.T, testEAD string, cachedResult *eadResult) {
+				breakGoldenFile(t, testEAD, testdataMismatchFileID)
+			},
+			expectedTested: true,
+		},
+		{
+			name: "indexer version changed",
+			change: func(t *testing.T, testEAD string, cachedResult *eadResult) {
+				indexerVersion = "other"
+			},
+			expectedTested: true,
+		},
+		{
+			name: "timed out",
+			change: func(t *testing.T, testEAD string, cachedResult *eadResult) {
+				cachedResult.Status = statusTimeout
+			},
+			expectedTested: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+
+			var output *eadTestOutput
+			captureOutput(t, func() {
+				output = testEADIfNeeded(testEAD)
+			})
+			cachedResult := output.result
+			if cachedResult.Status != statusPassed {
+				t.Fatalf("expected first test to pass, got %q: %s", cachedResult.Status, cachedResult.Stderr)
+			}
+
+			testCase.change(t, testEAD, &cachedResult)
+			cachedResults = map[string]eadResult{testEAD: cachedResult}
+			captureOutput(t, func() {
+				output = testEADIfNeeded(testEAD)
+			})
+
+			tested := strings.Contains(output.stdout.String(), "] Testing "+testEAD)
+			if tested != testCase.expectedTested {
+				t.Errorf("expected tested: %t, got stdout %q", testCase.expectedTested, output.stdout.String())
+			}
+			if !tested && !reflect.DeepEqual(output.result, cachedResult) {
+				t.Errorf("expected the cached result %+v, got %+v", cachedResult, output.result)
+			}
+		})
+	}
+}
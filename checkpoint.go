@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const journalFileName = "journal.jsonl"
+
+// The checkpoint journal has one JSON-encoded `journalRecord` per line,
+// appended as soon as each EAD finishes -- so the lines are in order of
+// completion, not in test EAD order.  An EAD is only recorded after all of its
+// outputs have been written, so any EAD which is not in the journal of an
+// interrupted run may have partial outputs and must be tested again.
+type journal struct {
+	file      *os.File
+	mutex     sync.Mutex
+	selection string
+}
+
+// The result includes the input hashes of the EAD, which are checked against
+// the current inputs before the result is reused, like a cached result.  The
+// selection is the hash of the shard and filters of the run which recorded the
+// result: see `getRunSelection`.
+type journalRecord struct {
+	Result    eadResult `json:"result"`
+	Selection string    `json:"selection"`
+}
+
+var checkpointJournal *journal
+
+// Results recorded in the checkpoint journal of an interrupted previous run,
+// keyed by test EAD.  Only populated when resuming.
+var completedResults = map[string]eadResult{}
+
+// Hashes the shard and the filters, including the contents of the EAD list
+// file.  A resumed run only reuses the results recorded by an interrupted run
+// which selected its EADs the same way.
+func getRunSelection() (string, error) {
+	eadList := slices.Sorted(maps.Keys(testFilters.eadList))
+	bytes, err := json.Marshal(struct {
+		EADList []string `json:"ead_list"`
+		Filters filters  `json:"filters"`
+		Shard   string   `json:"shard"`
+	}{eadList, testFilters.source, shard.String()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func journalFile() string {
+	return filepath.Join(outputDirPath, "tmp", journalFileName)
+}
+
+// Starts a new journal containing only `completedResults`, recorded with the
+// selection of the current run.  Any previous journal is replaced, which also
+// gets rid of a partially written last line left behind by an interrupted run,
+// and of records which `readJournal` ignored.
+func openJournal(completedResults map[string]eadResult) (*journal, error) {
+	selection, err := getRunSelection()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(journalFile()), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpJournalFile := journalFile() + ".tmp"
+	file, err := os.Create(tmpJournalFile)
+	if err != nil {
+		return nil, err
+	}
+
+	newJournal := journal{file: file, selection: selection}
+	for _, testEAD := range slices.Sorted(maps.Keys(completedResults)) {
+		err = newJournal.record(completedResults[testEAD])
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	err = os.Rename(tmpJournalFile, journalFile())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &newJournal, nil
+}
+
+// A missing journal is not an error: it means that the previous run didn't get
+// far enough to complete any EADs.  A line that can't be decoded should only be
+// the last one, cut off when the previous run was interrupted, so we stop
+// reading there, and log how much of the journal was dropped in case it wasn't.
+// Records from a run with a different shard or filters are ignored.  The input
+// hashes of the records are checked by `testEADIfNeeded`.
+func readJournal() (map[string]eadResult, error) {
+	results := map[string]eadResult{}
+
+	selection, err := getRunSelection()
+	if err != nil {
+		return results, err
+	}
+
+	file, err := os.Open(journalFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return results, nil
+		}
+		return results, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Lines are short, but allow plenty of room in case `eadResult` grows.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	numOtherSelection := 0
+	for scanner.Scan() {
+		lineNumber++
+		record := journalRecord{}
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			numDroppedLines := 1
+			for scanner.Scan() {
+				numDroppedLines++
+			}
+			log.Println(fmt.Sprintf("Checkpoint journal %s: line %d could not be decoded (%s).  "+
+				"Dropped %d lines from line %d on: those EADs will be tested again.",
+				journalFile(), lineNumber, err, numDroppedLines, lineNumber))
+			break
+		}
+		if record.Selection != selection {
+			numOtherSelection++
+			continue
+		}
+		results[record.Result.TestEAD] = record.Result
+	}
+
+	if numOtherSelection > 0 {
+		log.Println(fmt.Sprintf("Checkpoint journal %s: ignored %d EADs completed by a run with a different "+
+			"shard or filters: they will be tested again.", journalFile(), numOtherSelection))
+	}
+
+	return results, scanner.Err()
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
+
+// Safe to call from multiple workers.  The file is synced after every record so
+// that a completed EAD survives even a system crash.
+func (j *journal) record(result eadResult) error {
+	line, err := json.Marshal(journalRecord{Result: result, Selection: j.selection})
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_, err = j.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return j.file.Sync()
+}
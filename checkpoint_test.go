@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadJournal(t *testing.T) {
+	testCases := []struct {
+		name             string
+		change           func(t *testing.T)
+		expectedTestEADs []string
+		expectedLog      string
+	}{
+		{
+			name:             "complete journal",
+			change:           func(t *testing.T) {},
+			expectedTestEADs: []string{"test/tiny_001", "test/tiny_002", "test/tiny_003"},
+		},
+		{
+			name: "cut-off last line",
+			change: func(t *testing.T) {
+				contents, err := os.ReadFile(journalFile())
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(journalFile(), contents[:len(contents)-10], 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectedTestEADs: []string{"test/tiny_001", "test/tiny_002"},
+			expectedLog:      "line 3 could not be decoded",
+		},
+		{
+			name: "undecodable line in the middle",
+			change: func(t *testing.T) {
+				contents, err := os.ReadFile(journalFile())
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines := strings.SplitAfter(string(contents), "\n")
+				lines[1] = "garbage\n"
+				err = os.WriteFile(journalFile(), []byte(strings.Join(lines, "")), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectedTestEADs: []string{"test/tiny_001"},
+			expectedLog:      "Dropped 2 lines from line 2 on",
+		},
+		{
+			name: "different shard",
+			change: func(t *testing.T) {
+				shard.Set("1/2")
+			},
+			expectedTestEADs: []string{},
+			expectedLog:      "ignored 3 EADs completed by a run with a different shard or filters",
+		},
+		{
+			name: "different filters",
+			change: func(t *testing.T) {
+				setFilters(filters{ExcludeRepositories: []string{"other"}})
+			},
+			expectedTestEADs: []string{},
+			expectedLog:      "ignored 3 EADs completed by a run with a different shard or filters",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEADs := setUpTestRun(t, 3)
+			for _, testEAD := range testEADs {
+				err := checkpointJournal.record(eadResult{Status: statusPassed, TestEAD: testEAD})
+				if err != nil {
+					t.Fatalf("record() failed: %s", err)
+				}
+			}
+			testCase.change(t)
+
+			logOutput := bytes.Buffer{}
+			log.SetOutput(&logOutput)
+			defer log.SetOutput(os.Stderr)
+			results, err := readJournal()
+			if err != nil {
+				t.Fatalf("readJournal() failed: %s", err)
+			}
+
+			resultTestEADs := slices.Sorted(maps.Keys(results))
+			if !slices.Equal(resultTestEADs, testCase.expectedTestEADs) {
+				t.Errorf("expected results for %q, got %q", testCase.expectedTestEADs, resultTestEADs)
+			}
+			if testCase.expectedLog == "" && logOutput.Len() > 0 {
+				t.Errorf("expected no log output, got %q", logOutput.String())
+			}
+			if !strings.Contains(logOutput.String(), testCase.expectedLog) {
+				t.Errorf("expected log output containing %q, got %q", testCase.expectedLog, logOutput.String())
+			}
+		})
+	}
+}
+
+// When resuming, an EAD completed by the interrupted run is only skipped if its
+// inputs are unchanged and it didn't time out, as for the incremental cache.
+func TestTestEADIfNeededResume(t *testing.T) {
+	testCases := []struct {
+		name           string
+		change         func(t *testing.T, testEAD string)
+		expectedTested bool
+	}{
+		{
+			name:           "unchanged",
+			change:         func(t *testing.T, testEAD string) {},
+			expectedTested: false,
+		},
+		{
+			name: "golden file changed",
+			change: func(t *testing.T, testEAD string) {
+				breakGoldenFile(t, testEAD, testdataMismatchFileID)
+			},
+			expectedTested: true,
+		},
+		{
+			name: "massage rules changed",
+			change: func(t *testing.T, testEAD string) {
+				massageRulesHash = "other"
+			},
+			expectedTested: true,
+		},
+		{
+			name: "timed out",
+			change: func(t *testing.T, testEAD string) {
+				result := completedResults[testEAD]
+				result.Status = statusTimeout
+				completedResults[testEAD] = result
+			},
+			expectedTested: true,
+		},
+		{
+			name: "component filters changed",
+			change: func(t *testing.T, testEAD string) {
+				setFilters(filters{ExcludeComponents: []string{"ref3$"}})
+			},
+			expectedTested: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+
+			var output *eadTestOutput
+			captureOutput(t, func() {
+				output = testEADIfNeeded(testEAD)
+			})
+			var err error
+			completedResults, err = readJournal()
+			if err != nil {
+				t.Fatalf("readJournal() failed: %s", err)
+			}
+			if completedResults[testEAD].Status != statusPassed {
+				t.Fatalf("expected a passed result in the journal, got %+v", completedResults[testEAD])
+			}
+
+			testCase.change(t, testEAD)
+			captureOutput(t, func() {
+				output = testEADIfNeeded(testEAD)
+			})
+
+			tested := strings.Contains(output.stdout.String(), "] Testing "+testEAD)
+			if tested != testCase.expectedTested {
+				t.Errorf("expected tested: %t, got stdout %q", testCase.expectedTested, output.stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nyulibraries/go-ead-indexer/pkg/ead"
+	"github.com/nyulibraries/go-ead-indexer/pkg/ead/eadutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Exit statuses.  The Go runtime exits with status 2 for an unrecovered panic,
+// which we use for fatal errors, so panics are recovered by `exitOnPanic` to
+// keep them distinct from usage errors.
+const (
+	exitOK = 0
+	// The command ran, but found problems: golden mismatches for `show`,
+	// unreadable golden file directories for `list`, or shard outputs which
+	// don't make up a complete run for `merge`.
+	exitFailure = 1
+	exitUsage   = 2
+	exitPanic   = 3
+)
+
+type command struct {
+	name    string
+	run     func(args []string) int
+	summary string
+}
+
+var commands = []command{
+	{
+		name:    "run",
+		run:     cmdRun,
+		summary: "test all EADs against their golden files",
+	},
+	{
+		name:    "list",
+		run:     cmdList,
+		summary: "print the EADs and golden file IDs that would be tested",
+	},
+	{
+		name:    "show",
+		run:     cmdShow,
+		summary: "inspect the golden and actual values for a single file ID",
+	},
+	{
+		name:    "accept",
+		run:     cmdAccept,
+		summary: "copy actual values from the last run into the golden overlay",
+	},
+	{
+		name:    "report",
+		run:     cmdReport,
+		summary: "re-summarize the results in an existing output directory",
+	},
+	{
+		name:    "merge",
+		run:     cmdMerge,
+		summary: "combine the output directories of a sharded run",
+	},
+}
+
+// The roots are optional when they are given by flags or in the config file.
+const eadAndGoldenFilesDirsArgsUsage = "[[EAD root, e.g. findingaids_eads_v2] [golden files root, e.g. dlfa-188_v1-indexer-http-requests-xml/http-requests/]]"
+
+func cmdAccept(args []string) int {
+	flagSet := newFlagSet("accept", "[test EAD or file ID]...",
+		`Accepts the actual values which did not match their golden files in the last
+run as the correct values, by writing them to the golden overlay directory,
+wrapped in the HTTP request envelopes of the golden files they replace.
+
+Each arg is a test EAD of the form [repository code]/[EAD ID], which accepts
+all of its actual values, or a file ID.  Use -dry-run without args to list the
+actual values which can be accepted, with their diff signatures.
+
+Refuses to accept anything if any of the inputs of the EADs have changed since
+the last run, e.g. the EAD, the golden files, go-ead-indexer, the massage
+rules, or the comparison settings.  Give the same component filters as for the
+run.`)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addFilterFlags()
+	configFlags.addInputFlags()
+	configFlags.addOutputFlag("output directory of the run whose actual values to accept")
+	dryRun := flagSet.Bool("dry-run", false, "print what would be accepted, with diff signatures, without writing anything")
+	reason := flagSet.String("reason", "", "why the actual values are correct (required)")
+	targets := acceptTargets{}
+	flagSet.Func("signature", "accept every actual value whose diff has diff `signature`",
+		func(value string) error {
+			targets.signatures = append(targets.signatures, value)
+			return nil
+		})
+	ticket := flagSet.String("ticket", "", "Jira ticket for the correction, e.g. DLFA-251 (required)")
+	flagSet.Parse(args)
+
+	for _, arg := range flagSet.Args() {
+		if strings.Contains(arg, "/") {
+			targets.testEADs = append(targets.testEADs, arg)
+		} else {
+			targets.fileIDs = append(targets.fileIDs, arg)
+		}
+	}
+	if targets.isEmpty() && !*dryRun {
+		abortBadUsage(flagSet, fmt.Errorf("No test EADs, file IDs, or diff signatures to accept"))
+	}
+	if !*dryRun {
+		for _, required := range []struct{ name, value string }{{"-reason", *reason}, {"-ticket", *ticket}} {
+			if strings.TrimSpace(required.value) == "" {
+				abortBadUsage(flagSet, fmt.Errorf("%s is required", required.name))
+			}
+			// The values are written as HTTP headers.
+			if strings.ContainsAny(required.value, "\r\n") {
+				abortBadUsage(flagSet, fmt.Errorf("%s must be a single line", required.name))
+			}
+		}
+	}
+
+	loadedConfig := configFlags.load()
+	setInputConfig(flagSet, loadedConfig)
+	setOutputDirPaths(flagSet, loadedConfig.OutputRoot)
+
+	var err error
+	indexerVersion, err = getIndexerVersion()
+	if err != nil {
+		log.Panic("getIndexerVersion() error: " + err.Error())
+	}
+	massageRulesHash, err = getMassageRulesHash()
+	if err != nil {
+		log.Panic("getMassageRulesHash() error: " + err.Error())
+	}
+
+	candidates, err := getAcceptCandidates()
+	if err != nil {
+		log.Println(fmt.Sprintf(`No actual values could be read from output directory "%s": %s`,
+			outputDirPath, err))
+		return exitFailure
+	}
+	if !targets.isEmpty() {
+		unmatchedTargets := targets.unmatched(candidates)
+		if len(unmatchedTargets) > 0 {
+			log.Println("No actual values to accept for " + strings.Join(unmatchedTargets, ", "))
+			return exitFailure
+		}
+		candidates = slices.DeleteFunc(candidates, func(candidate acceptCandidate) bool {
+			return !targets.matches(candidate)
+		})
+	}
+
+	cache, err := readCache()
+	if err != nil {
+		log.Panic("readCache() error: " + err.Error())
+	}
+	staleTestEADs := []string{}
+	for _, candidate := range candidates {
+		if slices.Contains(staleTestEADs, candidate.testEAD) {
+			continue
+		}
+		err = checkActualFileIsCurrent(candidate.testEAD, cache)
+		if err != nil {
+			log.Println(fmt.Sprintf("Actual values for %s are stale: %s", candidate.testEAD, err))
+			staleTestEADs = append(staleTestEADs, candidate.testEAD)
+		}
+	}
+	if len(staleTestEADs) > 0 {
+		log.Println(`Nothing accepted.  Do a new "run" first.`)
+		return exitFailure
+	}
+
+	if *dryRun {
+		for _, candidate := range candidates {
+			fmt.Printf("%s %s %s\n", candidate.signature, candidate.testEAD, candidate.fileID)
+		}
+		return exitOK
+	}
+
+	overlays, err := acceptCandidates(candidates, *reason, *ticket)
+	for _, overlay := range overlays {
+		fmt.Printf("Accepted %s\n", filepath.Join(overlayDirPath, overlay.File))
+	}
+	if err != nil {
+		log.Println("acceptCandidates() failed: " + err.Error())
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func cmdList(args []string) int {
+	flagSet := newFlagSet("list", eadAndGoldenFilesDirsArgsUsage,
+		`Prints each EAD that "run" would test, in the order in which it would be
+tested, followed by the IDs of its golden files, indented.`)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addFilterFlags()
+	configFlags.addInputFlags()
+	eadsOnly := flagSet.Bool("eads-only", false, "print only the EADs, without their golden file IDs")
+	flagSet.Var(&shard, "shard", "only list shard `i/n` of the EADs, where 1 <= i <= n")
+	flagSet.Parse(args)
+
+	setInputConfig(flagSet, configFlags.loadWithRootArgs(flagSet.Args()))
+	testEADs, err := getTestEADs()
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+
+	exitStatus := exitOK
+	for _, testEAD := range testEADs {
+		fmt.Println(testEAD)
+		if *eadsOnly {
+			continue
+		}
+
+		goldenFileIDs, err := readGoldenFileIDs(testEAD)
+		if err != nil {
+			log.Println(fmt.Sprintf(`readGoldenFileIDs("%s") failed: %s`, testEAD, err))
+			exitStatus = exitFailure
+			continue
+		}
+		for _, goldenFileID := range goldenFileIDs {
+			if goldenFileID != parseEADID(testEAD) && !includesComponent(goldenFileID) {
+				continue
+			}
+			fmt.Println("    " + goldenFileID)
+		}
+	}
+
+	return exitStatus
+}
+
+func cmdMerge(args []string) int {
+	flagSet := newFlagSet("merge", "[shard output directory]...",
+		`Combines the output directories of all shards of a sharded run into a single
+output directory, which ends up looking as if the run had been done in a
+single process.`)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addFailOnFlag()
+	configFlags.addOutputFlag("directory to write the merged diffs/, tmp/, and logs/ to")
+	flagSet.Parse(args)
+
+	loadedConfig := configFlags.load()
+	summary, err := merge(flagSet, loadedConfig.OutputRoot, flagSet.Args())
+	if err != nil {
+		log.Println("Nothing merged: " + err.Error())
+		return exitFailure
+	}
+	writeSummary(os.Stdout, summary)
+
+	return getExitStatus(summary, loadedConfig.FailOn)
+}
+
+func cmdReport(args []string) int {
+	flagSet := newFlagSet("report", "",
+		`Prints a summary of the results recorded by the last "run" or "merge" in the
+output directory, and exits with a status based on them.`)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addFailOnFlag()
+	configFlags.addOutputFlag("output directory of the run to report on")
+	flagSet.Parse(args)
+
+	if flagSet.NArg() != 0 {
+		abortBadUsage(flagSet, fmt.Errorf("Wrong number of args"))
+	}
+	loadedConfig := configFlags.load()
+	setOutputDirPaths(flagSet, loadedConfig.OutputRoot)
+
+	results, err := readRunResults(outputDirPath)
+	if err != nil {
+		log.Println(fmt.Sprintf(`No results could be read from output directory "%s": %s`,
+			outputDirPath, err))
+		return exitFailure
+	}
+
+	summary := summarize(results)
+	writeReport(summary, results)
+
+	return getExitStatus(summary, loadedConfig.FailOn)
+}
+
+func cmdRun(args []string) int {
+	flagSet := newFlagSet("run", eadAndGoldenFilesDirsArgsUsage,
+		`Tests the Solr add messages generated by go-ead-indexer for every EAD against
+the golden files captured from the v1 indexer, writing diffs for mismatches.`)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addFailOnFlag()
+	configFlags.addFilterFlags()
+	configFlags.addInputFlags()
+	configFlags.addOutputFlag("directory to write crashes/, diffs/, tmp/, and the summary file to")
+	flagSet.BoolVar(&incremental, "incremental", false,
+		"only test EADs whose inputs have changed since the last run, and keep the previous outputs for the rest")
+	flagSet.BoolVar(&massageDiffs, "massage-diffs", false,
+		"for each mismatch, also write a diff of the raw and massaged golden values, labeled by massage rule, to diffs/")
+	flagSet.BoolVar(&resume, "resume", false,
+		"skip EADs completed by an interrupted previous run, and keep their outputs")
+	flagSet.Var(&shard, "shard", "only test shard `i/n` of the EADs, where 1 <= i <= n")
+	flagSet.DurationVar(&eadTimeout, "timeout", 0,
+		"maximum time to spend testing a single EAD, e.g. 10m (default: no limit)")
+	flagSet.IntVar(&numWorkers, "workers", 1, "number of EADs to test in parallel")
+	flagSet.Parse(args)
+
+	if numWorkers < 1 {
+		abortBadUsage(flagSet, fmt.Errorf("-workers must be at least 1"))
+	}
+
+	startTime := time.Now()
+	loadedConfig := configFlags.loadWithRootArgs(flagSet.Args())
+	setInputConfig(flagSet, loadedConfig)
+	setOutputDirPaths(flagSet, loadedConfig.OutputRoot)
+
+	// Before anything is written to the output directory.
+	allTestEADs := getAllTestEADs()
+	testEADs, err := selectTestEADs(allTestEADs)
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+
+	indexerVersion, err = getIndexerVersion()
+	if err != nil {
+		log.Panic("getIndexerVersion() error: " + err.Error())
+	}
+	massageRulesHash, err = getMassageRulesHash()
+	if err != nil {
+		log.Panic("getMassageRulesHash() error: " + err.Error())
+	}
+
+	if incremental {
+		cachedResults, err = readCache()
+		if err != nil {
+			log.Panic("readCache() error: " + err.Error())
+		}
+	}
+
+	if resume {
+		completedResults, err = readJournal()
+		if err != nil {
+			log.Panic("readJournal() error: " + err.Error())
+		}
+	} else if !incremental {
+		err = clean()
+		if err != nil {
+			log.Panic("clean() error: " + err.Error())
+		}
+	}
+
+	checkpointJournal, err = openJournal(completedResults)
+	if err != nil {
+		log.Panic("openJournal() error: " + err.Error())
+	}
+	defer checkpointJournal.close()
+
+	results := testAllEADs(testEADs, numWorkers)
+
+	// EADs which are still in the corpus but were excluded by the filters keep
+	// their outputs and cached results, so that an incremental run targeting a
+	// few EADs doesn't throw away the results of the last full run.
+	isFilteredOut := func(testEAD string) bool {
+		_, inCorpus := slices.BinarySearch(allTestEADs, testEAD)
+		return inCorpus && shard.contains(testEAD) && !includesTestEAD(testEAD)
+	}
+
+	// EADs which were removed from the corpus since the last run should not
+	// leave their outputs behind.
+	for _, previousResults := range []map[string]eadResult{cachedResults, completedResults} {
+		for previousTestEAD := range previousResults {
+			if !slices.Contains(testEADs, previousTestEAD) && !isFilteredOut(previousTestEAD) {
+				err = removeEADOutputs(previousTestEAD)
+				if err != nil {
+					log.Panic(fmt.Sprintf(`removeEADOutputs("%s") failed: %s`, previousTestEAD, err))
+				}
+			}
+		}
+	}
+
+	newCache := map[string]eadResult{}
+	for previousTestEAD, cachedResult := range cachedResults {
+		if isFilteredOut(previousTestEAD) {
+			newCache[previousTestEAD] = cachedResult
+		}
+	}
+	for _, result := range results {
+		newCache[result.TestEAD] = result
+	}
+	err = writeCache(newCache)
+	if err != nil {
+		log.Panic("writeCache() error: " + err.Error())
+	}
+
+	finalResults := runResults{
+		ElapsedSeconds:   time.Since(startTime).Seconds(),
+		MassageRules:     getMassageRuleNames(enabledMassageRules),
+		Results:          results,
+		Shard:            shard.String(),
+		StaleGoldenFixes: getStaleGoldenFixes(results, testEADs, allTestEADs),
+	}
+	err = writeRunResults(finalResults)
+	if err != nil {
+		log.Panic("writeRunResults() error: " + err.Error())
+	}
+
+	summary := summarize(finalResults)
+	err = writeSummaryFile(summary)
+	if err != nil {
+		log.Panic("writeSummaryFile() error: " + err.Error())
+	}
+
+	massageRulesReport := getMassageRulesReport(finalResults)
+	err = writeMassageRulesReportFile(massageRulesReport)
+	if err != nil {
+		log.Panic("writeMassageRulesReportFile() error: " + err.Error())
+	}
+
+	reportUntestedEADs(os.Stderr, results)
+	writeMassageRulesReport(os.Stdout, massageRulesReport)
+	writeSummary(os.Stdout, summary)
+
+	return getExitStatus(summary, loadedConfig.FailOn)
+}
+
+// Values for the `show -print` flag.
+const (
+	showPrintActual      = "actual"
+	showPrintDiff        = "diff"
+	showPrintFields      = "fields"
+	showPrintGolden      = "golden"
+	showPrintMassageDiff = "massage-diff"
+	showPrintMassaged    = "massaged"
+)
+
+func cmdShow(args []string) int {
+	flagSet := newFlagSet("show", eadAndGoldenFilesDirsArgsUsage+" [test EAD] [file ID]",
+		`Indexes a single EAD and prints the values for one of its Solr add messages.
+The test EAD is of the form [repository code]/[EAD ID].  The file ID defaults
+to the EAD ID, which is the file ID of the collection doc.
+
+Exits with status 1 if the massaged golden and actual values do not match.`)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addInputFlags()
+	printValue := flagSet.String("print", showPrintDiff,
+		fmt.Sprintf(`what to print: "%s" for the diff of the massaged golden value and the actual value, "%s" for the field-level changes between them, "%s" for the raw golden value, "%s" for the massaged golden value, "%s" for the diffs made to the golden value by each massage rule, or "%s" for the actual value`,
+			showPrintDiff, showPrintFields, showPrintGolden, showPrintMassaged, showPrintMassageDiff, showPrintActual))
+	flagSet.Parse(args)
+
+	if flagSet.NArg() < 1 || flagSet.NArg() > 4 {
+		abortBadUsage(flagSet, fmt.Errorf("Wrong number of args"))
+	}
+	if !slices.Contains([]string{showPrintActual, showPrintDiff, showPrintFields, showPrintGolden, showPrintMassageDiff,
+		showPrintMassaged}, *printValue) {
+		abortBadUsage(flagSet, fmt.Errorf(`Invalid -print value "%s"`, *printValue))
+	}
+
+	// The roots are given as args only if there are more than two args.
+	rootArgs := []string{}
+	testArgs := flagSet.Args()
+	if flagSet.NArg() > 2 {
+		rootArgs = testArgs[:2]
+		testArgs = testArgs[2:]
+	}
+	setInputConfig(flagSet, configFlags.loadWithRootArgs(rootArgs))
+
+	testEAD := testArgs[0]
+	fileID := parseEADID(testEAD)
+	if len(testArgs) == 2 {
+		fileID = testArgs[1]
+	}
+
+	goldenValue, err := getGoldenFileValue(testEAD, fileID)
+	if err != nil {
+		log.Println(fmt.Sprintf(`getGoldenFileValue("%s", "%s") failed: %s`, testEAD, fileID, err))
+		return exitFailure
+	}
+	isOverlay := getGoldenFilePath(testEAD, fileID) == getOverlayFilePath(testEAD, fileID)
+	if isOverlay {
+		log.Println(fmt.Sprintf("Using overlay file %s", getOverlayFilePath(testEAD, fileID)))
+	}
+	if *printValue == showPrintGolden {
+		fmt.Print(goldenValue)
+		return exitOK
+	}
+	if *printValue == showPrintMassageDiff {
+		if isOverlay {
+			fmt.Println("Overlay files are not massaged")
+			return exitOK
+		}
+		massageDiff, err := getMassageDiff(testEAD, fileID, goldenValue)
+		if err != nil {
+			log.Println(fmt.Sprintf(`getMassageDiff("%s", "%s") failed: %s`, testEAD, fileID, err))
+			return exitFailure
+		}
+		fmt.Print(massageDiff)
+		return exitOK
+	}
+
+	massagedGoldenValue, _, err := getMassagedGoldenValue(testEAD, fileID)
+	if err != nil {
+		log.Println(fmt.Sprintf(`getMassagedGoldenValue("%s", "%s") failed: %s`, testEAD, fileID, err))
+		return exitFailure
+	}
+	if *printValue == showPrintMassaged {
+		fmt.Print(eadutil.PrettifySolrAddMessageXML(massagedGoldenValue))
+		return exitOK
+	}
+
+	actualValue, err := getActualValue(testEAD, fileID)
+	if err != nil {
+		log.Println(fmt.Sprintf(`getActualValue("%s", "%s") failed: %s`, testEAD, fileID, err))
+		return exitFailure
+	}
+	if *printValue == showPrintActual {
+		fmt.Print(eadutil.PrettifySolrAddMessageXML(actualValue))
+		return exitOK
+	}
+
+	match, relaxations, err := compareSolrAddMessageXML(massagedGoldenValue, actualValue)
+	if err != nil {
+		log.Println(fmt.Sprintf(`compareSolrAddMessageXML() for "%s/%s" failed: %s`, testEAD, fileID, err))
+		return exitFailure
+	}
+	if match && len(relaxations) > 0 {
+		fmt.Printf("%s golden and actual values match only with relaxed comparison: %s\n",
+			fileID, strings.Join(relaxations, ", "))
+		return exitOK
+	}
+	if match {
+		fmt.Printf("%s golden and actual values match\n", fileID)
+		return exitOK
+	}
+
+	if *printValue == showPrintFields {
+		fieldDiffReport, err := getFieldDiffReport(testEAD, fileID, massagedGoldenValue, actualValue)
+		if err != nil {
+			log.Println(fmt.Sprintf(`getFieldDiffReport("%s", "%s") failed: %s`, testEAD, fileID, err))
+			return exitFailure
+		}
+		fmt.Print(getFieldDiffText(fieldDiffReport))
+		return exitFailure
+	}
+
+	fmt.Print(diffPrettified("golden", massagedGoldenValue, "actual", actualValue))
+
+	return exitFailure
+}
+
+// Must be deferred by `main` and by every goroutine that can panic outside of
+// the testing of an EAD, which recovers its own panics.  Prints the panic and
+// its stack trace like the Go runtime would, but exits with `exitPanic`.
+func exitOnPanic() {
+	if r := recover(); r != nil {
+		fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", r, debug.Stack())
+		os.Exit(exitPanic)
+	}
+}
+
+// Returns the Solr add message that go-ead-indexer generates for the collection
+// doc or component with ID `fileID`.
+func getActualValue(testEAD string, fileID string) (string, error) {
+	eadXML, err := getEADValue(testEAD)
+	if err != nil {
+		return "", err
+	}
+
+	eadToShow, err := ead.New(parseRepositoryCode(testEAD), eadXML)
+	if err != nil {
+		return "", err
+	}
+
+	if fileID == parseEADID(testEAD) {
+		return fmt.Sprintf("%s", eadToShow.CollectionDoc.SolrAddMessage), nil
+	}
+
+	if eadToShow.Components != nil {
+		for _, component := range *eadToShow.Components {
+			if component.ID == fileID {
+				return fmt.Sprintf("%s", component.SolrAddMessage), nil
+			}
+		}
+	}
+
+	return "", errors.New("go-ead-indexer did not generate a Solr add message with this ID")
+}
+
+func newFlagSet(name string, argsUsage string, description string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		fmt.Fprintf(out, "usage: go run . %s [flags] %s\n\n%s\n",
+			name, argsUsage, description)
+
+		hasFlags := false
+		flagSet.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nflags:")
+			flagSet.PrintDefaults()
+		}
+	}
+
+	return flagSet
+}
+
+func writeReport(summary runSummary, results runResults) {
+	failedTestEADs := []string{}
+	for _, result := range results.Results {
+		if result.Status == statusFailed {
+			failedTestEADs = append(failedTestEADs, result.TestEAD)
+		}
+	}
+
+	writeSummary(os.Stdout, summary)
+
+	if len(failedTestEADs) > 0 {
+		fmt.Printf("%d EADs failed:\n%s\n", len(failedTestEADs), strings.Join(failedTestEADs, "\n"))
+	}
+
+	reportUntestedEADs(os.Stdout, results.Results)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Runs the command with `args` as they would be given on the command line,
+// and returns its exit status and output, including the log output.
+func runCommand(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+
+	index := slices.IndexFunc(commands, func(command command) bool {
+		return command.name == args[0]
+	})
+	if index < 0 {
+		t.Fatalf("unknown command %q", args[0])
+	}
+
+	logOutput := bytes.Buffer{}
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+
+	exitStatus := 0
+	stdout, stderr := captureOutput(t, func() {
+		exitStatus = commands[index].run(args[1:])
+	})
+
+	return exitStatus, stdout, stderr + logOutput.String()
+}
+
+// The steps share one output directory, and each depends on the ones before
+// it, like a user working through a mismatch.
+func TestCommands(t *testing.T) {
+	setUpTestRun(t, 2)
+	breakGoldenFile(t, "test/tiny_002", testdataMismatchFileID)
+	outputDir := outputDirPath
+	roots := []string{eadDirPath, goldenFilesDirPath}
+	// `accept` takes the roots only as flags.
+	rootFlags := []string{"-ead-root", eadDirPath, "-golden-root", goldenFilesDirPath}
+	inputFlags := []string{"-overlay-root", overlayDirPath}
+	outputFlags := []string{"-output", outputDir}
+
+	testCases := []struct {
+		name               string
+		args               []string
+		expectedExitStatus int
+		expectedStdout     []string
+		expectedStderr     []string
+	}{
+		{
+			name:               "run with a mismatch",
+			args:               slices.Concat([]string{"run"}, inputFlags, outputFlags, roots),
+			expectedExitStatus: exitFailure,
+			expectedStdout:     []string{"] Testing test/tiny_001\n", "] Testing test/tiny_002\n"},
+			expectedStderr:     []string{testdataMismatchFileID + " golden and actual values do not match"},
+		},
+		{
+			name:               "run, never fail",
+			args:               slices.Concat([]string{"run", "-fail-on", failOnNever}, inputFlags, outputFlags, roots),
+			expectedExitStatus: exitOK,
+		},
+		{
+			name:               "report",
+			args:               slices.Concat([]string{"report"}, outputFlags),
+			expectedExitStatus: exitFailure,
+			expectedStdout:     []string{"1 EADs failed:\ntest/tiny_002\n"},
+		},
+		{
+			name:               "report, fail on errors",
+			args:               slices.Concat([]string{"report", "-fail-on", failOnErrors}, outputFlags),
+			expectedExitStatus: exitOK,
+		},
+		{
+			name:               "report on an empty output directory",
+			args:               []string{"report", "-output", t.TempDir()},
+			expectedExitStatus: exitFailure,
+			expectedStderr:     []string{"No results could be read from output directory"},
+		},
+		{
+			name:               "list",
+			args:               slices.Concat([]string{"list"}, inputFlags, roots),
+			expectedExitStatus: exitOK,
+			expectedStdout: []string{"test/tiny_001\n    tiny_001\n    tiny_001aspace_ref1\n" +
+				"    tiny_001aspace_ref2\n    tiny_001aspace_ref3\ntest/tiny_002\n    tiny_001aspace_ref1\n" +
+				"    tiny_001aspace_ref2\n    tiny_001aspace_ref3\n    tiny_002\n"},
+		},
+		{
+			name:               "list with filters",
+			args:               slices.Concat([]string{"list", "-ead", "tiny_002", "-exclude-component", "ref[12]$"}, inputFlags, roots),
+			expectedExitStatus: exitOK,
+			expectedStdout:     []string{"test/tiny_002\n    tiny_001aspace_ref3\n    tiny_002\n"},
+		},
+		{
+			name:               "show a match",
+			args:               slices.Concat([]string{"show"}, inputFlags, roots, []string{"test/tiny_001", testdataMismatchFileID}),
+			expectedExitStatus: exitOK,
+			expectedStdout:     []string{testdataMismatchFileID + " golden and actual values match\n"},
+		},
+		{
+			name:               "show a mismatch",
+			args:               slices.Concat([]string{"show"}, inputFlags, roots, []string{"test/tiny_002", testdataMismatchFileID}),
+			expectedExitStatus: exitFailure,
+			expectedStdout:     []string{"\n-    " + testdataMismatchNew + "\n+    " + testdataMismatchOld + "\n"},
+		},
+		{
+			name:               "show the fields of a mismatch",
+			args:               slices.Concat([]string{"show", "-print", showPrintFields}, inputFlags, roots, []string{"test/tiny_002", testdataMismatchFileID}),
+			expectedExitStatus: exitFailure,
+			expectedStdout:     []string{"unittitle_ssm"},
+		},
+		{
+			name:               "show the golden value",
+			args:               slices.Concat([]string{"show", "-print", showPrintGolden}, inputFlags, roots, []string{"test/tiny_002", testdataMismatchFileID}),
+			expectedExitStatus: exitOK,
+			expectedStdout:     []string{testdataMismatchNew},
+		},
+		{
+			name:               "show a file ID with no golden file",
+			args:               slices.Concat([]string{"show"}, inputFlags, roots, []string{"test/tiny_002", "tiny_002aspace_ref9"}),
+			expectedExitStatus: exitFailure,
+			expectedStderr:     []string{`getGoldenFileValue("test/tiny_002", "tiny_002aspace_ref9") failed`},
+		},
+		{
+			name:               "accept, dry run",
+			args:               slices.Concat([]string{"accept", "-dry-run"}, inputFlags, rootFlags, outputFlags),
+			expectedExitStatus: exitOK,
+			expectedStdout:     []string{" test/tiny_002 " + testdataMismatchFileID + "\n"},
+		},
+		{
+			name:               "accept a file ID which didn't mismatch",
+			args:               slices.Concat([]string{"accept", "-reason", "test", "-ticket", "DLFA-0"}, inputFlags, rootFlags, outputFlags, []string{"tiny_001aspace_ref1"}),
+			expectedExitStatus: exitFailure,
+			expectedStderr:     []string{`No actual values to accept for file ID "tiny_001aspace_ref1"`},
+		},
+		{
+			name:               "accept",
+			args:               slices.Concat([]string{"accept", "-reason", "test", "-ticket", "DLFA-0"}, inputFlags, rootFlags, outputFlags, []string{"test/tiny_002"}),
+			expectedExitStatus: exitOK,
+			expectedStdout:     []string{"Accepted " + getOverlayFilePath("test/tiny_002", testdataMismatchFileID)},
+		},
+		{
+			name:               "run with the overlay",
+			args:               slices.Concat([]string{"run"}, inputFlags, outputFlags, roots),
+			expectedExitStatus: exitOK,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			exitStatus, stdout, stderr := runCommand(t, testCase.args...)
+			if exitStatus != testCase.expectedExitStatus {
+				t.Errorf("expected exit status %d, got %d\nstdout: %s\nstderr: %s", testCase.expectedExitStatus,
+					exitStatus, stdout, stderr)
+			}
+			for _, expected := range testCase.expectedStdout {
+				if !strings.Contains(stdout, expected) {
+					t.Errorf("expected stdout to contain %q, got %q", expected, stdout)
+				}
+			}
+			for _, expected := range testCase.expectedStderr {
+				if !strings.Contains(stderr, expected) {
+					t.Errorf("expected stderr to contain %q, got %q", expected, stderr)
+				}
+			}
+		})
+	}
+}
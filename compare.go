@@ -0,0 +1,305 @@
+package main
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Values for `config.Comparison`.  "structural" parses the golden and actual
+// Solr add messages into docs and fields and compares them field by field, so
+// that differences in serialization -- character escaping, the XML declaration,
+// whitespace in field content -- are not mismatches.  "exact" compares the
+// serialized strings, as the DLFA-188 test originally did.
+const (
+	comparisonExact      = "exact"
+	comparisonStructural = "structural"
+)
+
+var comparisonModes = []string{comparisonExact, comparisonStructural}
+
+// Values for `config.FieldSemantics`, which say how the values of a
+// multi-valued field are compared in "structural" comparison: as an "ordered"
+// list (the default), as an unordered "multiset", or as a "set", which also
+// ignores repeated values.  The semantics only apply to the values of the
+// field relative to each other: under any of them, the field can move relative
+// to the other fields of the doc, which is reported as `relaxationFieldOrder`.
+const (
+	fieldSemanticsMultiset = "multiset"
+	fieldSemanticsOrdered  = "ordered"
+	fieldSemanticsSet      = "set"
+)
+
+var fieldSemanticsValues = []string{fieldSemanticsMultiset, fieldSemanticsOrdered, fieldSemanticsSet}
+
+// Relaxation reported when a doc's fields are in a different order: see
+// `solrDocsMatch`.
+const relaxationFieldOrder = "field order"
+
+// Set by `setComparisonMode` and `setFieldSemantics`.
+var comparisonMode = comparisonStructural
+var fieldSemantics = map[string]string{}
+
+// A Solr add message: <add><doc><field name="...">value</field>...</doc>...</add>
+// Unexpected attributes and child elements are kept so that they can be
+// compared too, rather than silently dropped by `xml.Unmarshal`.
+type solrAddMessage struct {
+	XMLName xml.Name     `xml:"add"`
+	Attrs   []xml.Attr   `xml:",any,attr"`
+	Docs    []solrDoc    `xml:"doc"`
+	Other   []xmlElement `xml:",any"`
+}
+
+type solrDoc struct {
+	Attrs  []xml.Attr   `xml:",any,attr"`
+	Fields []solrField  `xml:"field"`
+	Other  []xmlElement `xml:",any"`
+}
+
+type solrField struct {
+	Attrs []xml.Attr   `xml:",any,attr"`
+	Name  string       `xml:"name,attr"`
+	Other []xmlElement `xml:",any"`
+	Value string       `xml:",chardata"`
+}
+
+type xmlElement struct {
+	XMLName xml.Name
+}
+
+// Also returns the relaxations -- `relaxationFieldOrder`, and the fields with
+// "multiset" or "set" semantics whose values are in a different order or
+// repeated differently -- without which the values would not match.  A match
+// which needs relaxations is still a match, but it's reported, so that ordering
+// regressions stay visible.
+// Returns a `goldenFileError` if the golden value can't be parsed.  An actual
+// value which can't be parsed is a plain error.
+func compareSolrAddMessageXML(goldenValue string, actualValue string) (bool, []string, error) {
+	if comparisonMode == comparisonExact {
+		return goldenValue == actualValue, nil, nil
+	}
+
+	golden, err := parseSolrAddMessage(goldenValue)
+	if err != nil {
+		return false, nil, newGoldenFileError("golden value is not a valid Solr add message: %s", err)
+	}
+	actual, err := parseSolrAddMessage(actualValue)
+	if err != nil {
+		return false, nil, fmt.Errorf("actual value is not a valid Solr add message: %s", err)
+	}
+
+	match, relaxations := solrAddMessagesMatch(golden, actual)
+
+	return match, relaxations, nil
+}
+
+// For the incremental run cache.  Field semantics don't matter for "exact"
+// comparison.
+func getComparisonDescription() string {
+	if comparisonMode == comparisonExact {
+		return comparisonMode
+	}
+
+	semantics := []string{}
+	for _, fieldName := range slices.Sorted(maps.Keys(fieldSemantics)) {
+		semantics = append(semantics, fieldName+"="+fieldSemantics[fieldName])
+	}
+
+	return strings.TrimSpace(comparisonMode + " " + strings.Join(semantics, ","))
+}
+
+// In order, including repeated fields.
+func getFieldNames(fields []solrField) []string {
+	fieldNames := []string{}
+	for _, field := range fields {
+		fieldNames = append(fieldNames, field.Name)
+	}
+
+	return fieldNames
+}
+
+func getFieldSemantics(fieldName string) string {
+	return cmp.Or(fieldSemantics[fieldName], fieldSemanticsOrdered)
+}
+
+// Everything about a field but its name, for comparing field values.
+func getFieldValueKey(field solrField) string {
+	key := strings.Builder{}
+	key.WriteString(normalizeFieldValue(field.Value))
+	for _, attr := range slices.SortedFunc(slices.Values(field.Attrs), compareXMLAttrs) {
+		fmt.Fprintf(&key, "\x00%s %s=%s", attr.Name.Space, attr.Name.Local, attr.Value)
+	}
+	for _, other := range field.Other {
+		fmt.Fprintf(&key, "\x00<%s %s>", other.XMLName.Space, other.XMLName.Local)
+	}
+
+	return key.String()
+}
+
+func compareXMLAttrs(a xml.Attr, b xml.Attr) int {
+	return strings.Compare(a.Name.Space+" "+a.Name.Local, b.Name.Space+" "+b.Name.Local)
+}
+
+// Leading and trailing ASCII whitespace in field content is trimmed, like the
+// "leading-field-whitespace" and "trailing-field-whitespace" massage rules do
+// to the golden value for "exact" comparison, but without their NBSPs.
+// Whitespace inside the content is compared as is, so that doubled spaces or
+// NBSPs in go-ead-indexer's output are still reported.
+func normalizeFieldValue(value string) string {
+	return strings.Trim(value, " \t\n\v\f\r")
+}
+
+func parseSolrAddMessage(value string) (solrAddMessage, error) {
+	message := solrAddMessage{}
+
+	err := xml.Unmarshal([]byte(value), &message)
+	if err != nil {
+		return message, err
+	}
+
+	for _, doc := range message.Docs {
+		for _, field := range doc.Fields {
+			if field.Name == "" {
+				return message, fmt.Errorf(`<field> with no "name" attribute`)
+			}
+		}
+	}
+
+	return message, nil
+}
+
+// The relaxations of all docs are combined, in sorted order.
+func solrAddMessagesMatch(golden solrAddMessage, actual solrAddMessage) (bool, []string) {
+	if !xmlAttrsEqual(golden.Attrs, actual.Attrs) || !slices.Equal(golden.Other, actual.Other) ||
+		len(golden.Docs) != len(actual.Docs) {
+		return false, nil
+	}
+
+	relaxations := []string{}
+	for i := range golden.Docs {
+		match, docRelaxations := solrDocsMatch(golden.Docs[i], actual.Docs[i])
+		if !match {
+			return false, nil
+		}
+		relaxations = append(relaxations, docRelaxations...)
+	}
+	slices.Sort(relaxations)
+
+	return true, slices.Compact(relaxations)
+}
+
+// Fields are first compared in order, including repeated fields.  If they
+// don't match, the values of each field are compared according to its
+// semantics, regardless of where the field is in the doc, so even the values
+// of an "ordered" field can be interleaved differently with other fields.
+//
+// The fields are reported as reordered if they first appear in a different
+// order, or if the same fields, repeated the same number of times, are in a
+// different order.  A field which is only repeated a different number of
+// times, which can only match under "set" semantics, is not reordered.
+func solrDocsMatch(golden solrDoc, actual solrDoc) (bool, []string) {
+	if !xmlAttrsEqual(golden.Attrs, actual.Attrs) || !slices.Equal(golden.Other, actual.Other) {
+		return false, nil
+	}
+
+	if slices.EqualFunc(golden.Fields, actual.Fields, func(goldenField solrField, actualField solrField) bool {
+		return goldenField.Name == actualField.Name && getFieldValueKey(goldenField) == getFieldValueKey(actualField)
+	}) {
+		return true, nil
+	}
+
+	goldenValues, goldenFieldNames := groupFieldValues(golden.Fields)
+	actualValues, actualFieldNames := groupFieldValues(actual.Fields)
+	if !slices.Equal(slices.Sorted(slices.Values(goldenFieldNames)), slices.Sorted(slices.Values(actualFieldNames))) {
+		return false, nil
+	}
+
+	relaxations := []string{}
+	goldenFieldSequence := getFieldNames(golden.Fields)
+	actualFieldSequence := getFieldNames(actual.Fields)
+	sameFieldCounts := slices.Equal(slices.Sorted(slices.Values(goldenFieldSequence)),
+		slices.Sorted(slices.Values(actualFieldSequence)))
+	if !slices.Equal(goldenFieldNames, actualFieldNames) ||
+		(sameFieldCounts && !slices.Equal(goldenFieldSequence, actualFieldSequence)) {
+
+		relaxations = append(relaxations, relaxationFieldOrder)
+	}
+	for _, fieldName := range goldenFieldNames {
+		if slices.Equal(goldenValues[fieldName], actualValues[fieldName]) {
+			continue
+		}
+
+		semantics := getFieldSemantics(fieldName)
+		if !fieldValuesMatch(goldenValues[fieldName], actualValues[fieldName], semantics) {
+			return false, nil
+		}
+		relaxations = append(relaxations, fmt.Sprintf("%s (%s)", fieldName, semantics))
+	}
+
+	return true, relaxations
+}
+
+func fieldValuesMatch(golden []string, actual []string, semantics string) bool {
+	switch semantics {
+	case fieldSemanticsMultiset:
+		return slices.Equal(slices.Sorted(slices.Values(golden)), slices.Sorted(slices.Values(actual)))
+	case fieldSemanticsSet:
+		return slices.Equal(slices.Compact(slices.Sorted(slices.Values(golden))),
+			slices.Compact(slices.Sorted(slices.Values(actual))))
+	default:
+		return slices.Equal(golden, actual)
+	}
+}
+
+// Returns the value keys of each field, in order, and the field names in the
+// order in which each first appears.
+func groupFieldValues(fields []solrField) (map[string][]string, []string) {
+	values := map[string][]string{}
+	fieldNames := []string{}
+	for _, field := range fields {
+		if _, ok := values[field.Name]; !ok {
+			fieldNames = append(fieldNames, field.Name)
+		}
+		values[field.Name] = append(values[field.Name], getFieldValueKey(field))
+	}
+
+	return values, fieldNames
+}
+
+func setComparisonMode(mode string) error {
+	if mode == "" {
+		mode = comparisonStructural
+	}
+	if !slices.Contains(comparisonModes, mode) {
+		return fmt.Errorf(`Invalid comparison "%s".  Valid comparisons: %s`,
+			mode, strings.Join(comparisonModes, ", "))
+	}
+	comparisonMode = mode
+
+	return nil
+}
+
+// Names of fields not in the map have "ordered" semantics.
+func setFieldSemantics(semantics map[string]string) error {
+	for fieldName, fieldSemanticsValue := range semantics {
+		if !slices.Contains(fieldSemanticsValues, fieldSemanticsValue) {
+			return fmt.Errorf(`Invalid semantics "%s" for field "%s".  Valid semantics: %s`,
+				fieldSemanticsValue, fieldName, strings.Join(fieldSemanticsValues, ", "))
+		}
+	}
+	fieldSemantics = maps.Clone(semantics)
+	if fieldSemantics == nil {
+		fieldSemantics = map[string]string{}
+	}
+
+	return nil
+}
+
+// The order of attributes is not significant in XML.
+func xmlAttrsEqual(a []xml.Attr, b []xml.Attr) bool {
+	return slices.Equal(slices.SortedFunc(slices.Values(a), compareXMLAttrs),
+		slices.SortedFunc(slices.Values(b), compareXMLAttrs))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCompareSolrAddMessageXML(t *testing.T) {
+	const golden = `<?xml version="1.0" encoding="UTF-8"?><add><doc><field name="id">a</field><field name="title_ssm">Cars &amp; Map</field></doc></add>`
+
+	testCases := []struct {
+		name               string
+		actual             string
+		expectedExact      bool
+		expectedStructural bool
+	}{
+		{
+			name:               "identical",
+			actual:             golden,
+			expectedExact:      true,
+			expectedStructural: true,
+		},
+		{
+			name:               "no XML declaration and different escaping",
+			actual:             `<add><doc><field name="id">a</field><field name="title_ssm">Cars &#38; Map</field></doc></add>`,
+			expectedExact:      false,
+			expectedStructural: true,
+		},
+		{
+			name:               "leading and trailing whitespace in field content",
+			actual:             "<add><doc><field name=\"id\">a</field><field name=\"title_ssm\">\n Cars &amp; Map \t</field></doc></add>",
+			expectedExact:      false,
+			expectedStructural: true,
+		},
+		{
+			name:               "doubled space in field content",
+			actual:             `<add><doc><field name="id">a</field><field name="title_ssm">Cars  &amp; Map</field></doc></add>`,
+			expectedExact:      false,
+			expectedStructural: false,
+		},
+		{
+			name:               "NBSP in field content",
+			actual:             "<add><doc><field name=\"id\">a</field><field name=\"title_ssm\">Cars\u00a0&amp; Map</field></doc></add>",
+			expectedExact:      false,
+			expectedStructural: false,
+		},
+		{
+			name:               "leading NBSP in field content",
+			actual:             "<add><doc><field name=\"id\">a</field><field name=\"title_ssm\">\u00a0Cars &amp; Map</field></doc></add>",
+			expectedExact:      false,
+			expectedStructural: false,
+		},
+		{
+			name:               "different field value",
+			actual:             `<add><doc><field name="id">a</field><field name="title_ssm">Cars &amp;amp; Map</field></doc></add>`,
+			expectedExact:      false,
+			expectedStructural: false,
+		},
+		{
+			name:               "extra attribute",
+			actual:             `<add><doc><field name="id">a</field><field name="title_ssm" boost="2">Cars &amp; Map</field></doc></add>`,
+			expectedExact:      false,
+			expectedStructural: false,
+		},
+		{
+			name:               "extra doc",
+			actual:             `<add><doc><field name="id">a</field><field name="title_ssm">Cars &amp; Map</field></doc><doc/></add>`,
+			expectedExact:      false,
+			expectedStructural: false,
+		},
+	}
+
+	defer setComparisonMode("")
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for _, expected := range []struct {
+				mode  string
+				match bool
+			}{
+				{comparisonExact, testCase.expectedExact},
+				{comparisonStructural, testCase.expectedStructural},
+			} {
+				err := setComparisonMode(expected.mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				match, _, err := compareSolrAddMessageXML(golden, testCase.actual)
+				if err != nil {
+					t.Fatalf("%s: compareSolrAddMessageXML() failed: %s", expected.mode, err)
+				}
+				if match != expected.match {
+					t.Errorf("%s: expected match %t, got %t", expected.mode, expected.match, match)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareSolrAddMessageXMLInvalidGolden(t *testing.T) {
+	defer setComparisonMode("")
+	err := setComparisonMode(comparisonStructural)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = compareSolrAddMessageXML(`<add><doc><field name="id">a</doc></add>`, `<add/>`)
+	if !errors.As(err, &goldenFileError{}) {
+		t.Errorf("expected a goldenFileError, got %v", err)
+	}
+}
+
+func TestCompareSolrAddMessageXMLFieldSemantics(t *testing.T) {
+	const golden = `<add><doc><field name="id">a</field><field name="subject_teim">x</field><field name="subject_teim">y</field><field name="subject_teim">y</field><field name="series_sim">s</field></doc></add>`
+
+	testCases := []struct {
+		name                string
+		actual              string
+		semantics           map[string]string
+		expectedMatch       bool
+		expectedRelaxations []string
+	}{
+		{
+			name:                "same order",
+			actual:              golden,
+			expectedMatch:       true,
+			expectedRelaxations: nil,
+		},
+		{
+			name:                "fields out of order",
+			actual:              `<add><doc><field name="id">a</field><field name="series_sim">s</field><field name="subject_teim">x</field><field name="subject_teim">y</field><field name="subject_teim">y</field></doc></add>`,
+			expectedMatch:       true,
+			expectedRelaxations: []string{relaxationFieldOrder},
+		},
+		{
+			name:          "values out of order, ordered",
+			actual:        `<add><doc><field name="id">a</field><field name="subject_teim">y</field><field name="subject_teim">x</field><field name="subject_teim">y</field><field name="series_sim">s</field></doc></add>`,
+			expectedMatch: false,
+		},
+		{
+			name:                "values out of order, multiset",
+			actual:              `<add><doc><field name="id">a</field><field name="subject_teim">y</field><field name="subject_teim">x</field><field name="subject_teim">y</field><field name="series_sim">s</field></doc></add>`,
+			semantics:           map[string]string{"subject_teim": fieldSemanticsMultiset},
+			expectedMatch:       true,
+			expectedRelaxations: []string{"subject_teim (multiset)"},
+		},
+		{
+			name:          "repeated value missing, multiset",
+			actual:        `<add><doc><field name="id">a</field><field name="subject_teim">y</field><field name="subject_teim">x</field><field name="series_sim">s</field></doc></add>`,
+			semantics:     map[string]string{"subject_teim": fieldSemanticsMultiset},
+			expectedMatch: false,
+		},
+		{
+			name:                "repeated value missing, set",
+			actual:              `<add><doc><field name="id">a</field><field name="subject_teim">y</field><field name="subject_teim">x</field><field name="series_sim">s</field></doc></add>`,
+			semantics:           map[string]string{"subject_teim": fieldSemanticsSet},
+			expectedMatch:       true,
+			expectedRelaxations: []string{"subject_teim (set)"},
+		},
+		{
+			name:                "repeated value missing and fields out of order, set",
+			actual:              `<add><doc><field name="id">a</field><field name="series_sim">s</field><field name="subject_teim">y</field><field name="subject_teim">x</field></doc></add>`,
+			semantics:           map[string]string{"subject_teim": fieldSemanticsSet},
+			expectedMatch:       true,
+			expectedRelaxations: []string{relaxationFieldOrder, "subject_teim (set)"},
+		},
+		{
+			name:                "values interleaved with another field, ordered",
+			actual:              `<add><doc><field name="id">a</field><field name="subject_teim">x</field><field name="subject_teim">y</field><field name="series_sim">s</field><field name="subject_teim">y</field></doc></add>`,
+			expectedMatch:       true,
+			expectedRelaxations: []string{relaxationFieldOrder},
+		},
+		{
+			name:          "different value, set",
+			actual:        `<add><doc><field name="id">a</field><field name="subject_teim">x</field><field name="subject_teim">z</field><field name="series_sim">s</field></doc></add>`,
+			semantics:     map[string]string{"subject_teim": fieldSemanticsSet},
+			expectedMatch: false,
+		},
+	}
+
+	defer setFieldSemantics(nil)
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := setFieldSemantics(testCase.semantics)
+			if err != nil {
+				t.Fatal(err)
+			}
+			match, relaxations, err := compareSolrAddMessageXML(golden, testCase.actual)
+			if err != nil {
+				t.Fatalf("compareSolrAddMessageXML() failed: %s", err)
+			}
+			if match != testCase.expectedMatch {
+				t.Errorf("expected match %t, got %t", testCase.expectedMatch, match)
+			}
+			if match && !slices.Equal(relaxations, testCase.expectedRelaxations) {
+				t.Errorf("expected relaxations %q, got %q", testCase.expectedRelaxations, relaxations)
+			}
+		})
+	}
+}
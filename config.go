@@ -0,0 +1,384 @@
+package main
+
+import (
+	"dlfa_250_set_up_all_ead_test_for_go_ead_indexer_package/diff"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Settings which can be given in a JSON config file instead of on the command
+// line.  Relative paths are relative to the directory of the config file.
+// Flags and positional args override the corresponding config file settings.
+type config struct {
+	// See `comparisonStructural` etc.  Defaults to "structural".
+	Comparison string `json:"comparison"`
+	// The number of unchanged lines around each change in the diffs.  Defaults
+	// to 3.
+	DiffContext *int `json:"diff_context"`
+	// Regexps for lines whose changes are left out of the diffs, e.g. a field
+	// with a timestamp: see `setDiffOptions`.
+	DiffIgnoreLines []string `json:"diff_ignore_lines"`
+	EADRoot         string   `json:"ead_root"`
+	// See `failOnAny` etc.  Defaults to "any".
+	FailOn string `json:"fail_on"`
+	// Keyed by field name.  See `fieldSemanticsOrdered` etc.  Fields which
+	// aren't listed are "ordered".
+	FieldSemantics map[string]string `json:"field_semantics"`
+	Filters        filters           `json:"filters"`
+	GoldenRoot     string            `json:"golden_root"`
+	// IDs of the massage rules to apply, in the order defined by the massage
+	// rules file.  All rules are applied if not set.
+	MassageRules []string `json:"massage_rules"`
+	// Defaults to the shipped massage-rules.json.
+	MassageRulesFile string `json:"massage_rules_file"`
+	OutputRoot       string `json:"output_root"`
+	// Corrected golden files, which take priority over the ones in the golden
+	// files root.  Defaults to golden-overlay/ in this package's directory.
+	OverlayRoot string `json:"overlay_root"`
+}
+
+// The config file flag and the flags which override config file settings.
+type configFlags struct {
+	configFile string
+	flagSet    *flag.FlagSet
+	overrides  config
+}
+
+func newConfigFlags(flagSet *flag.FlagSet) *configFlags {
+	configFlags := &configFlags{flagSet: flagSet}
+	flagSet.StringVar(&configFlags.configFile, "config", "", "JSON config `file`")
+
+	return configFlags
+}
+
+// For commands which read the EADs and golden files.
+func (configFlags *configFlags) addInputFlags() {
+	configFlags.flagSet.StringVar(&configFlags.overrides.Comparison, "comparison", "",
+		fmt.Sprintf(`how to compare golden and actual values: "%s" to compare the docs and fields of the Solr add messages, or "%s" to compare the serialized strings (default "%s")`,
+			comparisonStructural, comparisonExact, comparisonStructural))
+	configFlags.flagSet.Func("field-semantics",
+		fmt.Sprintf(`compare the values of a field as "%s", "%s", or "%s", given as `+"`field=semantics`"+` (can be repeated, replaces the config file field semantics)`,
+			fieldSemanticsOrdered, fieldSemanticsMultiset, fieldSemanticsSet),
+		func(value string) error {
+			fieldName, semantics, ok := strings.Cut(value, "=")
+			if !ok || fieldName == "" {
+				return fmt.Errorf(`expected field=semantics, got "%s"`, value)
+			}
+			if configFlags.overrides.FieldSemantics == nil {
+				configFlags.overrides.FieldSemantics = map[string]string{}
+			}
+			configFlags.overrides.FieldSemantics[fieldName] = semantics
+			return nil
+		})
+	configFlags.flagSet.Func("diff-context",
+		fmt.Sprintf("show `lines` unchanged lines around each change in the diffs (default %d)", diff.DefaultContext),
+		func(value string) error {
+			context, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			configFlags.overrides.DiffContext = &context
+			return nil
+		})
+	configFlags.flagSet.Func("diff-ignore-lines",
+		"leave changes in which every changed line matches `regexp` out of the diffs (can be repeated, replaces the config file regexps)",
+		func(value string) error {
+			configFlags.overrides.DiffIgnoreLines = append(configFlags.overrides.DiffIgnoreLines, value)
+			return nil
+		})
+	configFlags.flagSet.StringVar(&configFlags.overrides.EADRoot, "ead-root", "",
+		"`path` to findingaids_eads_v2 or another directory of [repository code]/[EAD ID].xml files")
+	configFlags.flagSet.StringVar(&configFlags.overrides.GoldenRoot, "golden-root", "",
+		"`path` to dlfa-188_v1-indexer-http-requests-xml/http-requests/ or another directory of [repository code]/[EAD ID]/[file ID]-add.txt files")
+	configFlags.flagSet.Func("massage-rules",
+		"comma-separated `IDs` of the massage rules to apply (default: all rules in the massage rules file)",
+		func(value string) error {
+			configFlags.overrides.MassageRules = strings.Split(value, ",")
+			return nil
+		})
+	configFlags.flagSet.StringVar(&configFlags.overrides.MassageRulesFile, "massage-rules-file", "",
+		"JSON `file` of golden file massage rules (default: massage-rules.json in this package's directory)")
+	configFlags.flagSet.StringVar(&configFlags.overrides.OverlayRoot, "overlay-root", "",
+		"`path` to a directory of corrected [repository code]/[EAD ID]/[file ID]-add.txt files which replace the golden files (default: golden-overlay/ in this package's directory)")
+}
+
+// For commands which exit with a status based on the results of a run.
+func (configFlags *configFlags) addFailOnFlag() {
+	configFlags.flagSet.StringVar(&configFlags.overrides.FailOn, "fail-on", "",
+		fmt.Sprintf(`exit with status 1 if: "%s" EADs failed or could not be tested, "%s" EADs could not be tested, or "%s" (default "%s")`,
+			failOnAny, failOnErrors, failOnNever, failOnAny))
+}
+
+// For commands which select test EADs.  Each flag can be repeated, and replaces
+// the corresponding config file filter list.
+func (configFlags *configFlags) addFilterFlags() {
+	appendTo := func(filterList *[]string) func(string) error {
+		return func(value string) error {
+			*filterList = append(*filterList, value)
+			return nil
+		}
+	}
+
+	overrides := &configFlags.overrides.Filters
+	configFlags.flagSet.Func("component", "only test components whose IDs match `regexp`",
+		appendTo(&overrides.IncludeComponents))
+	configFlags.flagSet.Func("ead", "only test EADs whose IDs match `glob`", appendTo(&overrides.IncludeEADs))
+	configFlags.flagSet.StringVar(&overrides.EADListFile, "ead-list", "",
+		"only test the EADs listed in `file`, one [repository code]/[EAD ID] per line")
+	configFlags.flagSet.Func("exclude-component", "don't test components whose IDs match `regexp`",
+		appendTo(&overrides.ExcludeComponents))
+	configFlags.flagSet.Func("exclude-ead", "don't test EADs whose IDs match `glob`", appendTo(&overrides.ExcludeEADs))
+	configFlags.flagSet.Func("exclude-repo", "don't test EADs in repository `code`",
+		appendTo(&overrides.ExcludeRepositories))
+	configFlags.flagSet.Func("repo", "only test EADs in repository `code`", appendTo(&overrides.IncludeRepositories))
+}
+
+// For commands which read or write an output directory.
+func (configFlags *configFlags) addOutputFlag(usage string) {
+	configFlags.flagSet.StringVar(&configFlags.overrides.OutputRoot, "output", "",
+		usage+" (default: this package's directory)")
+}
+
+// Reads the config file, if there is one, and applies the overrides.
+func (configFlags *configFlags) load() config {
+	loadedConfig := config{}
+	if configFlags.configFile != "" {
+		var err error
+		loadedConfig, err = readConfig(configFlags.configFile)
+		if err != nil {
+			abortBadUsage(configFlags.flagSet, fmt.Errorf(`Config file "%s" could not be read: %s`,
+				configFlags.configFile, err))
+		}
+	}
+
+	if configFlags.overrides.Comparison != "" {
+		loadedConfig.Comparison = configFlags.overrides.Comparison
+	}
+	if configFlags.overrides.DiffContext != nil {
+		loadedConfig.DiffContext = configFlags.overrides.DiffContext
+	}
+	if configFlags.overrides.DiffIgnoreLines != nil {
+		loadedConfig.DiffIgnoreLines = configFlags.overrides.DiffIgnoreLines
+	}
+	if configFlags.overrides.EADRoot != "" {
+		loadedConfig.EADRoot = configFlags.overrides.EADRoot
+	}
+	if configFlags.overrides.FailOn != "" {
+		loadedConfig.FailOn = configFlags.overrides.FailOn
+	}
+	if loadedConfig.FailOn == "" {
+		loadedConfig.FailOn = failOnAny
+	}
+	err := validateFailOn(loadedConfig.FailOn)
+	if err != nil {
+		abortBadUsage(configFlags.flagSet, err)
+	}
+
+	if configFlags.overrides.FieldSemantics != nil {
+		loadedConfig.FieldSemantics = configFlags.overrides.FieldSemantics
+	}
+
+	overrideFilters := configFlags.overrides.Filters
+	if overrideFilters.EADListFile != "" {
+		loadedConfig.Filters.EADListFile = overrideFilters.EADListFile
+	}
+	for _, filterList := range []struct{ config, override *[]string }{
+		{&loadedConfig.Filters.ExcludeComponents, &overrideFilters.ExcludeComponents},
+		{&loadedConfig.Filters.ExcludeEADs, &overrideFilters.ExcludeEADs},
+		{&loadedConfig.Filters.ExcludeRepositories, &overrideFilters.ExcludeRepositories},
+		{&loadedConfig.Filters.IncludeComponents, &overrideFilters.IncludeComponents},
+		{&loadedConfig.Filters.IncludeEADs, &overrideFilters.IncludeEADs},
+		{&loadedConfig.Filters.IncludeRepositories, &overrideFilters.IncludeRepositories},
+	} {
+		if *filterList.override != nil {
+			*filterList.config = *filterList.override
+		}
+	}
+	if configFlags.overrides.GoldenRoot != "" {
+		loadedConfig.GoldenRoot = configFlags.overrides.GoldenRoot
+	}
+	if configFlags.overrides.MassageRules != nil {
+		loadedConfig.MassageRules = configFlags.overrides.MassageRules
+	}
+	if configFlags.overrides.MassageRulesFile != "" {
+		loadedConfig.MassageRulesFile = configFlags.overrides.MassageRulesFile
+	}
+	if configFlags.overrides.OutputRoot != "" {
+		loadedConfig.OutputRoot = configFlags.overrides.OutputRoot
+	}
+	if configFlags.overrides.OverlayRoot != "" {
+		loadedConfig.OverlayRoot = configFlags.overrides.OverlayRoot
+	}
+
+	return loadedConfig
+}
+
+// For commands which take the EAD and golden files roots as optional
+// positional args, which override both the config file and the flags.
+func (configFlags *configFlags) loadWithRootArgs(rootArgs []string) config {
+	if len(rootArgs) != 0 && len(rootArgs) != 2 {
+		abortBadUsage(configFlags.flagSet, fmt.Errorf("Wrong number of args"))
+	}
+
+	loadedConfig := configFlags.load()
+	if len(rootArgs) == 2 {
+		loadedConfig.EADRoot = rootArgs[0]
+		loadedConfig.GoldenRoot = rootArgs[1]
+	}
+
+	return loadedConfig
+}
+
+func readConfig(configFile string) (config, error) {
+	loadedConfig := config{}
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		return loadedConfig, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	// A misspelled key would otherwise be silently ignored.
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&loadedConfig)
+	if err != nil {
+		return loadedConfig, err
+	}
+
+	configDir := filepath.Dir(configFile)
+	for _, path := range []*string{&loadedConfig.EADRoot, &loadedConfig.Filters.EADListFile,
+		&loadedConfig.GoldenRoot, &loadedConfig.MassageRulesFile, &loadedConfig.OutputRoot,
+		&loadedConfig.OverlayRoot} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(configDir, *path)
+		}
+	}
+
+	return loadedConfig, nil
+}
+
+func resolveDirectoryPath(dir string) (string, error) {
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	fileInfo, err := os.Stat(resolvedPath)
+	if err != nil {
+		return "", err
+	}
+	if !fileInfo.IsDir() {
+		return "", errors.New("not a directory")
+	}
+
+	return resolvedPath, nil
+}
+
+// Sets the paths, filters, massage rules, comparison settings, and diff options
+// for commands which read the EADs and golden files.
+func setInputConfig(flagSet *flag.FlagSet, loadedConfig config) {
+	if loadedConfig.EADRoot == "" || loadedConfig.GoldenRoot == "" {
+		abortBadUsage(flagSet, fmt.Errorf("The EAD root and golden files root must be given as args, flags, or in the config file"))
+	}
+	setDirectoryPaths(flagSet, loadedConfig.EADRoot, loadedConfig.GoldenRoot)
+	setOverlayDirPath(flagSet, loadedConfig.OverlayRoot)
+
+	err := setFilters(loadedConfig.Filters)
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+
+	err = setMassageRules(loadedConfig.MassageRulesFile, loadedConfig.MassageRules)
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+
+	err = setComparisonMode(loadedConfig.Comparison)
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+	err = setFieldSemantics(loadedConfig.FieldSemantics)
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+
+	err = setDiffOptions(loadedConfig.DiffContext, loadedConfig.DiffIgnoreLines)
+	if err != nil {
+		abortBadUsage(flagSet, err)
+	}
+}
+
+// An EAD root must contain at least one [repository code]/[EAD ID].xml file.
+func validateEADRoot(eadRoot string) error {
+	repositoryDirs, err := os.ReadDir(eadRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, repositoryDir := range repositoryDirs {
+		if !repositoryDir.IsDir() || strings.HasPrefix(repositoryDir.Name(), ".") {
+			continue
+		}
+
+		eadFiles, err := os.ReadDir(filepath.Join(eadRoot, repositoryDir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, eadFile := range eadFiles {
+			if !eadFile.IsDir() && filepath.Ext(eadFile.Name()) == ".xml" {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("no [repository code]/[EAD ID].xml files found")
+}
+
+// A golden files root must contain at least one
+// [repository code]/[EAD ID]/[file ID]-add.txt file.
+func validateGoldenRoot(goldenRoot string) error {
+	repositoryDirs, err := os.ReadDir(goldenRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, repositoryDir := range repositoryDirs {
+		if !repositoryDir.IsDir() || strings.HasPrefix(repositoryDir.Name(), ".") {
+			continue
+		}
+
+		eadDirs, err := os.ReadDir(filepath.Join(goldenRoot, repositoryDir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, eadDir := range eadDirs {
+			if !eadDir.IsDir() {
+				continue
+			}
+
+			goldenFiles, err := os.ReadDir(filepath.Join(goldenRoot, repositoryDir.Name(), eadDir.Name()))
+			if err != nil {
+				return err
+			}
+			for _, goldenFile := range goldenFiles {
+				if !goldenFile.IsDir() && strings.HasSuffix(goldenFile.Name(), goldenFileSuffix) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("no [repository code]/[EAD ID]/[file ID]%s files found", goldenFileSuffix)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configFile
+}
+
+func TestReadConfig(t *testing.T) {
+	configFile := writeTestConfigFile(t, `{
+  "ead_root": "eads",
+  "golden_root": "/absolute/http-requests",
+  "filters": {"ead_list_file": "lists/eads.txt", "include_repositories": ["fales"]},
+  "massage_rules_file": "../rules.json",
+  "output_root": "output",
+  "overlay_root": "overlay"
+}`)
+	configDir := filepath.Dir(configFile)
+
+	loadedConfig, err := readConfig(configFile)
+	if err != nil {
+		t.Fatalf("readConfig() failed: %s", err)
+	}
+
+	// Relative paths are relative to the directory of the config file.
+	for _, path := range []struct{ name, expected, actual string }{
+		{"ead_root", filepath.Join(configDir, "eads"), loadedConfig.EADRoot},
+		{"golden_root", "/absolute/http-requests", loadedConfig.GoldenRoot},
+		{"ead_list_file", filepath.Join(configDir, "lists", "eads.txt"), loadedConfig.Filters.EADListFile},
+		{"massage_rules_file", filepath.Join(filepath.Dir(configDir), "rules.json"), loadedConfig.MassageRulesFile},
+		{"output_root", filepath.Join(configDir, "output"), loadedConfig.OutputRoot},
+		{"overlay_root", filepath.Join(configDir, "overlay"), loadedConfig.OverlayRoot},
+	} {
+		if path.actual != path.expected {
+			t.Errorf("%s: expected %q, got %q", path.name, path.expected, path.actual)
+		}
+	}
+	if !reflect.DeepEqual(loadedConfig.Filters.IncludeRepositories, []string{"fales"}) {
+		t.Errorf(`include_repositories: expected ["fales"], got %q`, loadedConfig.Filters.IncludeRepositories)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		contents      string
+		expectedError string
+	}{
+		{name: "misspelled key", contents: `{"ead_roots": "eads"}`, expectedError: `unknown field "ead_roots"`},
+		{name: "wrong type", contents: `{"massage_rules": "nbsp-entities"}`, expectedError: "cannot unmarshal string"},
+		{name: "not JSON", contents: `ead_root = "eads"`, expectedError: "invalid character"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := readConfig(writeTestConfigFile(t, testCase.contents))
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("expected error containing %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+// Flags override the config file, and the root args override both.
+func TestConfigFlagsLoad(t *testing.T) {
+	configFile := writeTestConfigFile(t, `{
+  "comparison": "exact",
+  "diff_context": 1,
+  "diff_ignore_lines": ["timestamp"],
+  "ead_root": "/config/eads",
+  "fail_on": "errors",
+  "field_semantics": {"subject_teim": "set"},
+  "filters": {"exclude_eads": ["a*"], "include_repositories": ["fales"]},
+  "golden_root": "/config/http-requests",
+  "massage_rules": ["nbsp-entities"],
+  "output_root": "/config/output"
+}`)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected func(expected *config)
+	}{
+		{
+			name:     "no flags",
+			args:     []string{},
+			expected: func(expected *config) {},
+		},
+		{
+			name: "flags",
+			args: []string{"-comparison", "structural", "-ead-root", "/flag/eads", "-fail-on", "never",
+				"-field-semantics", "name_teim=multiset", "-massage-rules", "em-unittitle,whitespace",
+				"-output", "/flag/output"},
+			expected: func(expected *config) {
+				expected.Comparison = "structural"
+				expected.EADRoot = "/flag/eads"
+				expected.FailOn = "never"
+				expected.FieldSemantics = map[string]string{"name_teim": "multiset"}
+				expected.MassageRules = []string{"em-unittitle", "whitespace"}
+				expected.OutputRoot = "/flag/output"
+			},
+		},
+		{
+			name: "diff flags",
+			args: []string{"-diff-context", "0", "-diff-ignore-lines", "a", "-diff-ignore-lines", "b"},
+			expected: func(expected *config) {
+				context := 0
+				expected.DiffContext = &context
+				expected.DiffIgnoreLines = []string{"a", "b"}
+			},
+		},
+		{
+			name: "filter flags replace only their own lists",
+			args: []string{"-repo", "tamwag", "-repo", "nyhs", "-component", "ref1$"},
+			expected: func(expected *config) {
+				expected.Filters.IncludeRepositories = []string{"tamwag", "nyhs"}
+				expected.Filters.IncludeComponents = []string{"ref1$"}
+			},
+		},
+		{
+			name: "root args",
+			args: []string{"-ead-root", "/flag/eads", "-golden-root", "/flag/http-requests",
+				"/arg/eads", "/arg/http-requests"},
+			expected: func(expected *config) {
+				expected.EADRoot = "/arg/eads"
+				expected.GoldenRoot = "/arg/http-requests"
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			expected, err := readConfig(configFile)
+			if err != nil {
+				t.Fatalf("readConfig() failed: %s", err)
+			}
+			testCase.expected(&expected)
+
+			flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+			configFlags := newConfigFlags(flagSet)
+			configFlags.addFailOnFlag()
+			configFlags.addFilterFlags()
+			configFlags.addInputFlags()
+			configFlags.addOutputFlag("output")
+			err = flagSet.Parse(append([]string{"-config", configFile}, testCase.args...))
+			if err != nil {
+				t.Fatalf("Parse() failed: %s", err)
+			}
+
+			loadedConfig := configFlags.loadWithRootArgs(flagSet.Args())
+			if !reflect.DeepEqual(loadedConfig, expected) {
+				t.Errorf("expected %+v, got %+v", expected, loadedConfig)
+			}
+		})
+	}
+}
+
+// "any" is the default for -fail-on.
+func TestConfigFlagsLoadDefaults(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	configFlags := newConfigFlags(flagSet)
+	configFlags.addFailOnFlag()
+	err := flagSet.Parse([]string{})
+	if err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+
+	loadedConfig := configFlags.load()
+	if !reflect.DeepEqual(loadedConfig, config{FailOn: failOnAny}) {
+		t.Errorf("expected only the default fail_on, got %+v", loadedConfig)
+	}
+}
+
+func TestValidateRoots(t *testing.T) {
+	setUpTestRun(t, 1)
+	emptyDir := t.TempDir()
+
+	testCases := []struct {
+		name          string
+		validate      func(string) error
+		root          string
+		expectedError string
+	}{
+		{name: "EAD root", validate: validateEADRoot, root: eadDirPath},
+		{name: "golden files root", validate: validateGoldenRoot, root: goldenFilesDirPath},
+		{name: "golden files root as EAD root", validate: validateEADRoot, root: goldenFilesDirPath,
+			expectedError: "no [repository code]/[EAD ID].xml files found"},
+		{name: "EAD root as golden files root", validate: validateGoldenRoot, root: eadDirPath,
+			expectedError: "no [repository code]/[EAD ID]/[file ID]-add.txt files found"},
+		{name: "empty EAD root", validate: validateEADRoot, root: emptyDir,
+			expectedError: "no [repository code]/[EAD ID].xml files found"},
+		{name: "missing golden files root", validate: validateGoldenRoot, root: filepath.Join(emptyDir, "missing"),
+			expectedError: "no such file or directory"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.validate(testCase.root)
+			if testCase.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("expected error containing %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+)
+
+const crashFileSuffix = "-crash.txt"
+
+// An error which prevents an EAD from being tested at all, as opposed to a test
+// failure like a golden file mismatch or a missing component.
+type executionError struct {
+	err error
+}
+
+func (e executionError) Error() string {
+	return e.err.Error()
+}
+
+func (e executionError) Unwrap() error {
+	return e.err
+}
+
+func newExecutionError(format string, a ...any) error {
+	return executionError{err: fmt.Errorf(format, a...)}
+}
+
+func crashFile(testEAD string) string {
+	return filepath.Join(crashesDirPath, testEAD+crashFileSuffix)
+}
+
+// Relative to the output directory, so that it's still correct after `merge`.
+func relativeCrashFile(testEAD string) string {
+	relativePath, _ := filepath.Rel(outputDirPath, crashFile(testEAD))
+
+	return relativePath
+}
+
+func writeCrashFile(testEAD string, message string, stack []byte) error {
+	crashFile := crashFile(testEAD)
+	err := os.MkdirAll(filepath.Dir(crashFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	crashReport := strings.Builder{}
+	fmt.Fprintf(&crashReport, "Test EAD: %s\n", testEAD)
+	fmt.Fprintf(&crashReport, "Error: %s\n\n", message)
+	crashReport.Write(stack)
+
+	return os.WriteFile(crashFile, []byte(crashReport.String()), 0644)
+}
+
+// Records the EAD as errored and writes its crash file.  Any failures logged
+// before the error are kept in the stderr log, but the result status is
+// "errored" regardless, because the EAD was not completely tested.
+func (output *eadTestOutput) errored(message string, stack []byte) {
+	output.logger.Println(fmt.Sprintf("ERROR: %s could not be tested: %s", output.result.TestEAD, message))
+	output.result.Error = message
+	output.result.Status = statusErrored
+
+	err := guardedWrite(output.result.TestEAD, func() error {
+		return writeCrashFile(output.result.TestEAD, message, stack)
+	})
+	if err != nil {
+		output.logger.Println(fmt.Sprintf(`writeCrashFile("%s") failed: %s`, output.result.TestEAD, err))
+		return
+	}
+
+	output.result.CrashFile = relativeCrashFile(output.result.TestEAD)
+}
+
+// Must be called directly by `defer` in the function that tests the EAD:
+// `recover()` only stops a panic when called directly by a deferred function.
+func (output *eadTestOutput) recoverPanic() {
+	if r := recover(); r != nil {
+		output.errored(fmt.Sprintf("panic: %v", r), debug.Stack())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+
+	output := func() (output *eadTestOutput) {
+		output = newEADTestOutput(testEAD)
+		defer output.recoverPanic()
+		panic("boom")
+	}()
+
+	if output.result.Status != statusErrored {
+		t.Errorf("expected status %q, got %q", statusErrored, output.result.Status)
+	}
+	if output.result.Error != "panic: boom" {
+		t.Errorf(`expected error "panic: boom", got %q`, output.result.Error)
+	}
+	expectedCrashFile := filepath.Join("crashes", testEAD+crashFileSuffix)
+	if output.result.CrashFile != expectedCrashFile {
+		t.Errorf("expected crash file %q, got %q", expectedCrashFile, output.result.CrashFile)
+	}
+
+	crashReport, err := os.ReadFile(filepath.Join(outputDirPath, output.result.CrashFile))
+	if err != nil {
+		t.Fatalf("reading crash file failed: %s", err)
+	}
+	for _, expected := range []string{"Test EAD: " + testEAD + "\n", "Error: panic: boom\n\n",
+		"TestRecoverPanic"} {
+		if !strings.Contains(string(crashReport), expected) {
+			t.Errorf("expected crash file to contain %q, got %q", expected, crashReport)
+		}
+	}
+}
+
+// Panics and execution errors stop the testing of the EAD, which is recorded
+// as errored with a crash file.
+func TestTestSingleEADErrored(t *testing.T) {
+	testCases := []struct {
+		name          string
+		change        func(t *testing.T, testEAD string)
+		expectedError string
+	}{
+		{
+			name: "EAD can't be parsed",
+			change: func(t *testing.T, testEAD string) {
+				err := os.WriteFile(getEADFilePath(testEAD), []byte("<ead><eadheader>"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectedError: "ead.New(",
+		},
+		{
+			name: "EAD file is a directory",
+			change: func(t *testing.T, testEAD string) {
+				err := os.Remove(getEADFilePath(testEAD))
+				if err == nil {
+					err = os.Mkdir(getEADFilePath(testEAD), 0755)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectedError: "getEADValue(",
+		},
+		{
+			name: "massage rule panics",
+			change: func(t *testing.T, testEAD string) {
+				enabledMassageRules = []massageRule{{
+					ID:   "panics",
+					Kind: massageKindBuiltin,
+					massage: func(golden string, fileID string) (string, int, error) {
+						panic("massage rule panicked")
+					},
+				}}
+			},
+			expectedError: "panic: massage rule panicked",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+			testCase.change(t, testEAD)
+
+			output := testSingleEAD(testEAD)
+			if output.result.Status != statusErrored {
+				t.Fatalf("expected status %q, got %q: %s", statusErrored, output.result.Status,
+					output.stderr.String())
+			}
+			if !strings.HasPrefix(output.result.Error, testCase.expectedError) {
+				t.Errorf("expected error starting with %q, got %q", testCase.expectedError, output.result.Error)
+			}
+			if !strings.Contains(output.stderr.String(), "ERROR: "+testEAD+" could not be tested: ") {
+				t.Errorf("expected the error to be logged, got %q", output.stderr.String())
+			}
+			if _, err := os.Stat(crashFile(testEAD)); err != nil {
+				t.Errorf("expected a crash file: %s", err)
+			}
+		})
+	}
+}
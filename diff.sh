@@ -16,8 +16,11 @@ LOG_DIR=$ROOT/logs
 EAD_DIR=$1
 # Local clone of https://github.com/NYULibraries/dlfa-188_v1-indexer-http-requests-xml/tree/develop/http-requests
 GOLDEN_FILES_DIR=$2
+# Any remaining args are passed through as flags -- e.g. `-workers 8`.
+shift 2
 
-time go run main.go \
+time go run . run \
+    "$@" \
     $EAD_DIR \
     $GOLDEN_FILES_DIR \
     2>$LOG_DIR/$(date +"%Y-%m-%d_%H-%M-%S")_stderr.log \
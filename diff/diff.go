@@ -6,7 +6,9 @@ package diff
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -43,33 +45,237 @@ type pair struct{ x, y int }
 // Second, the name is frequently interpreted as meaning that you have
 // to wait longer (to be patient) for the diff, meaning that it is a slower algorithm,
 // when in fact the algorithm is faster than the standard one.
+//
+// Texts that repeat most of their lines, such as prettified XML,
+// can have too few unique lines to anchor a useful diff.
+// DiffWithOptions with the Auto or Minimal algorithm handles those.
 func Diff(oldName string, old []byte, newName string, new []byte) []byte {
+	return DiffWithOptions(oldName, old, newName, new, Options{Context: DefaultContext, Algorithm: Anchored})
+}
+
+// DefaultContext is the number of context lines printed by Diff.
+const DefaultContext = 3
+
+// Options control the output of DiffWithOptions.
+// The zero Options prints no context lines and uses the Auto algorithm.
+type Options struct {
+	// Context is the number of unchanged lines printed before and after
+	// each change. Changes separated by fewer than 2*Context unchanged
+	// lines are printed in the same hunk.
+	Context int
+
+	// WholeFile prints the whole file as a single hunk,
+	// as if Context were larger than the file.
+	WholeFile bool
+
+	// OmitHeader omits the “diff”, “---”, and “+++” header lines,
+	// so that the output starts with the first hunk.
+	OmitHeader bool
+
+	// OldLabel and NewLabel, if not empty, replace oldName and newName
+	// in the “---” and “+++” header lines, as in diff --label.
+	// The “diff” header line always shows oldName and newName.
+	OldLabel string
+	NewLabel string
+
+	// IgnoreBlankLines ignores changes in which every inserted and
+	// removed line is empty or contains only white space.
+	IgnoreBlankLines bool
+
+	// IgnoreLines, if not nil, ignores changes in which every inserted and
+	// removed line matches the regular expression. The line is matched
+	// without its trailing newline.
+	//
+	// As with diff -B and -I, ignored changes do not start hunks of their own,
+	// but they are printed as changes if they fall within the context of
+	// a hunk for another change. If all changes are ignored,
+	// DiffWithOptions returns a nil slice.
+	IgnoreLines *regexp.Regexp
+
+	// Algorithm is the algorithm used to match lines. The zero value, Auto,
+	// uses the anchored algorithm unless its anchors are too few.
+	Algorithm Algorithm
+}
+
+// An Algorithm is an algorithm for matching the lines of old and new.
+type Algorithm int
+
+const (
+	// Auto uses Anchored, unless the lines that appear exactly once in
+	// both old and new match fewer than minAnchored of the lines of the
+	// shorter text. Then it uses Minimal, if Minimal finds a diff with
+	// at most maxLineD lines inserted and removed, and Anchored otherwise.
+	Auto Algorithm = iota
+
+	// Anchored matches only the lines that appear exactly once in both
+	// old and new, and the unchanged lines around them. It is fast,
+	// but in texts that repeat many lines it can report large hunks
+	// for small changes.
+	Anchored
+
+	// Minimal matches as many lines as possible, giving a diff with the
+	// fewest lines inserted and removed. It takes time and space quadratic
+	// in the number of lines inserted and removed.
+	Minimal
+)
+
+// minAnchored is the fraction of the lines of the shorter text which
+// Auto requires the anchors to match before it settles for Anchored.
+const minAnchored = 0.5
+
+// maxLineD is the largest number of lines inserted and removed
+// for which Auto looks for a minimal diff.
+const maxLineD = 2000
+
+// DiffWithOptions returns a diff of the two texts old and new,
+// like Diff, but with the output controlled by opts.
+// If old and new are identical, DiffWithOptions returns a nil slice (no output).
+func DiffWithOptions(oldName string, old []byte, newName string, new []byte, opts Options) []byte {
+	return Structured(old, new, opts).Unified(oldName, newName, opts)
+}
+
+// An Op is the kind of an Edit.
+type Op byte
+
+const (
+	Equal  Op = ' ' // the line is in both old and new
+	Delete Op = '-' // the line is only in old
+	Insert Op = '+' // the line is only in new
+)
+
+// An Edit is one step of an edit script turning old into new:
+// keeping line Old of old as line New of new, deleting line Old of old,
+// or inserting line New of new. Line numbers are 0-indexed.
+// For a deletion, New is the line of new before which the line would have been,
+// and for an insertion, Old is the line of old before which the line is inserted.
+type Edit struct {
+	Op       Op
+	Old, New int
+	Line     string // the line, including its newline
+}
+
+// A Hunk is a group of nearby changes, with the unchanged lines around them.
+// OldStart and NewStart are the 0-indexed lines of old and new where the hunk
+// starts, and OldLines and NewLines are the numbers of lines of old and new
+// in the hunk.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Edits              []Edit
+}
+
+// A Result is a structured diff of two texts.
+type Result struct {
+	// Edits is the edit script turning the whole of old into new.
+	// It is empty if old and new are identical.
+	Edits []Edit
+
+	// Hunks are the hunks to show, as chosen by the options.
+	// Their Edits are subslices of Edits.
+	// Hunks is empty if old and new are identical,
+	// or if all changes are ignored.
+	Hunks []Hunk
+}
+
+// Structured returns a diff of the two texts old and new,
+// like Diff, as a Result. The opts that control the matching of lines
+// and which hunks are chosen -- Algorithm, Context, WholeFile,
+// IgnoreBlankLines, and IgnoreLines -- apply.
+func Structured(old, new []byte, opts Options) Result {
 	if bytes.Equal(old, new) {
-		return nil
+		return Result{}
 	}
 	x := lines(old)
 	y := lines(new)
 
-	// Print diff header.
+	script := editScript(x, y, match(x, y, opts.Algorithm))
+	return Result{Edits: script, Hunks: hunks(script, opts)}
+}
+
+// match returns the pairs of indexes of matching lines of x and y,
+// with a leading {0,0} and trailing {len(x), len(y)} pair, as tgs does,
+// found with the given algorithm.
+func match(x, y []string, algorithm Algorithm) []pair {
+	var anchors []pair
+	if algorithm != Minimal {
+		anchors = tgs(x, y)
+		if algorithm == Anchored || float64(len(anchors)-2) >= minAnchored*float64(min(len(x), len(y))) {
+			return anchors
+		}
+	}
+
+	maxD := maxLineD
+	if algorithm == Minimal {
+		maxD = -1
+	}
+	matches, ok := myers(x, y, maxD)
+	if !ok {
+		return anchors
+	}
+	matches = append([]pair{{0, 0}}, matches...)
+	return append(matches, pair{len(x), len(y)})
+}
+
+// Counts returns the number of lines deleted from old and inserted in new
+// by the whole edit script.
+func (r Result) Counts() (deleted, inserted int) {
+	for _, e := range r.Edits {
+		switch e.Op {
+		case Delete:
+			deleted++
+		case Insert:
+			inserted++
+		}
+	}
+	return deleted, inserted
+}
+
+// Unified returns the result in the “unified diff” format, as Diff does.
+// The opts that control the header -- OmitHeader, OldLabel, and NewLabel -- apply.
+// If the result has no hunks, Unified returns a nil slice (no output).
+func (r Result) Unified(oldName, newName string, opts Options) []byte {
+	if len(r.Hunks) == 0 {
+		return nil
+	}
+
 	var out bytes.Buffer
-	fmt.Fprintf(&out, "diff %s %s\n", oldName, newName)
-	fmt.Fprintf(&out, "--- %s\n", oldName)
-	fmt.Fprintf(&out, "+++ %s\n", newName)
+	if !opts.OmitHeader {
+		fmt.Fprintf(&out, "diff %s %s\n", oldName, newName)
+		fmt.Fprintf(&out, "--- %s\n", cmp.Or(opts.OldLabel, oldName))
+		fmt.Fprintf(&out, "+++ %s\n", cmp.Or(opts.NewLabel, newName))
+	}
+	for _, h := range r.Hunks {
+		// Convert line numbers to 1-indexed.
+		// Special case: empty file shows up as 0,0 not 1,0.
+		start := pair{h.OldStart, h.NewStart}
+		if h.OldLines > 0 {
+			start.x++
+		}
+		if h.NewLines > 0 {
+			start.y++
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", start.x, h.OldLines, start.y, h.NewLines)
+		for _, e := range h.Edits {
+			out.WriteString(string(e.Op) + e.Line)
+		}
+	}
+	return out.Bytes()
+}
 
+// editScript returns the edit script for turning x into y
+// which keeps the matched lines and the lines around them.
+func editScript(x, y []string, matches []pair) []Edit {
 	// Loop over matches to consider,
-	// expanding each match to include surrounding lines,
-	// and then printing diff chunks.
+	// expanding each match to include surrounding lines.
 	// To avoid setup/teardown cases outside the loop,
-	// tgs returns a leading {0,0} and trailing {len(x), len(y)} pair
+	// match returns a leading {0,0} and trailing {len(x), len(y)} pair
 	// in the sequence of matches.
 	var (
-		done  pair     // printed up to x[:done.x] and y[:done.y]
-		chunk pair     // start lines of current chunk
-		count pair     // number of lines from each side in current chunk
-		ctext []string // lines for current chunk
+		script []Edit
+		done   pair // handled up to x[:done.x] and y[:done.y]
 	)
-	for _, m := range tgs(x, y) {
-		if m.x < done.x {
+	for _, m := range matches {
+		if m.x < done.x || m.y < done.y {
 			// Already handled scanning forward from earlier match.
 			continue
 		}
@@ -89,78 +295,79 @@ func Diff(oldName string, old []byte, newName string, new []byte) []byte {
 			end.y++
 		}
 
-		// Emit the mismatched lines before start into this chunk.
-		// (No effect on first sentinel iteration, when start = {0,0}.)
-		for _, s := range x[done.x:start.x] {
-			ctext = append(ctext, "-"+s)
-			count.x++
+		// Emit the mismatched lines before start, then the matching lines.
+		for i := done.x; i < start.x; i++ {
+			script = append(script, Edit{Delete, i, done.y, x[i]})
+		}
+		for j := done.y; j < start.y; j++ {
+			script = append(script, Edit{Insert, start.x, j, y[j]})
 		}
-		for _, s := range y[done.y:start.y] {
-			ctext = append(ctext, "+"+s)
-			count.y++
+		for i, j := start.x, start.y; i < end.x; i, j = i+1, j+1 {
+			script = append(script, Edit{Equal, i, j, x[i]})
 		}
+		done = end
+	}
+	return script
+}
 
-		// If we're not at EOF and have too few common lines,
-		// the chunk includes all the common lines and continues.
-		const C = 3 // number of context lines
-		if (end.x < len(x) || end.y < len(y)) &&
-			(end.x-start.x < C || (len(ctext) > 0 && end.x-start.x < 2*C)) {
-			for _, s := range x[start.x:end.x] {
-				ctext = append(ctext, " "+s)
-				count.x++
-				count.y++
-			}
-			done = end
+// hunks returns the hunks of the edit script to show,
+// each of them a group of changes with the context lines around them.
+func hunks(script []Edit, opts Options) []Hunk {
+	ignore := func(line string) bool {
+		line, _, _ = strings.Cut(line, "\n")
+		return opts.IgnoreBlankLines && strings.TrimSpace(line) == "" ||
+			opts.IgnoreLines != nil && opts.IgnoreLines.MatchString(line)
+	}
+
+	C := opts.Context
+	if opts.WholeFile {
+		C = len(script)
+	}
+
+	// Find the ranges script[start:end] of the hunks.
+	var ranges []pair
+	for i := 0; i < len(script); {
+		if script[i].Op == Equal {
+			i++
 			continue
 		}
 
-		// End chunk with common lines for context.
-		if len(ctext) > 0 {
-			n := end.x - start.x
-			if n > C {
-				n = C
-			}
-			for _, s := range x[start.x : start.x+n] {
-				ctext = append(ctext, " "+s)
-				count.x++
-				count.y++
-			}
-			done = pair{start.x + n, start.y + n}
-
-			// Format and emit chunk.
-			// Convert line numbers to 1-indexed.
-			// Special case: empty file shows up as 0,0 not 1,0.
-			if count.x > 0 {
-				chunk.x++
-			}
-			if count.y > 0 {
-				chunk.y++
+		// Find the change starting at i, and decide whether to ignore it.
+		start := i
+		ignored := opts.IgnoreBlankLines || opts.IgnoreLines != nil
+		for ; i < len(script) && script[i].Op != Equal; i++ {
+			if !ignore(script[i].Line) {
+				ignored = false
 			}
-			fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", chunk.x, count.x, chunk.y, count.y)
-			for _, s := range ctext {
-				out.WriteString(s)
-			}
-			count.x = 0
-			count.y = 0
-			ctext = ctext[:0]
 		}
-
-		// If we reached EOF, we're done.
-		if end.x >= len(x) && end.y >= len(y) {
-			break
+		if ignored {
+			continue
 		}
 
-		// Otherwise start a new chunk.
-		chunk = pair{end.x - C, end.y - C}
-		for _, s := range x[chunk.x:end.x] {
-			ctext = append(ctext, " "+s)
-			count.x++
-			count.y++
+		// Add the change to the last hunk if there are
+		// fewer than 2*C lines in between, or start a new hunk.
+		r := pair{max(start-C, 0), min(i+C, len(script))}
+		if n := len(ranges); n > 0 && start-ranges[n-1].y < C {
+			ranges[n-1].y = r.y
+		} else {
+			ranges = append(ranges, r)
 		}
-		done = end
 	}
 
-	return out.Bytes()
+	var out []Hunk
+	for _, r := range ranges {
+		h := Hunk{OldStart: script[r.x].Old, NewStart: script[r.x].New, Edits: script[r.x:r.y]}
+		for _, e := range h.Edits {
+			if e.Op != Insert {
+				h.OldLines++
+			}
+			if e.Op != Delete {
+				h.NewLines++
+			}
+		}
+		out = append(out, h)
+	}
+	return out
 }
 
 // lines returns the lines in the file x, including newlines.
@@ -0,0 +1,166 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Granularity is the unit of text compared by InlineDiff.
+type Granularity int
+
+const (
+	// Chars compares single runes.
+	Chars Granularity = iota
+	// Words compares runs of letters and digits, runs of spaces,
+	// and single punctuation runes, so that a change to part of a word
+	// replaces the whole word.
+	Words
+)
+
+// An InlineOp says which side of an InlineDiff a run of text is in.
+type InlineOp int
+
+const (
+	InlineEqual  InlineOp = iota // in both old and new
+	InlineDelete                 // only in old
+	InlineInsert                 // only in new
+)
+
+// An InlineEdit is a run of text in an InlineDiff.
+type InlineEdit struct {
+	Op   InlineOp
+	Text string
+}
+
+// A Span is the half-open range [Start, End) of byte offsets
+// of a changed run of text within a line.
+type Span struct {
+	Start, End int
+}
+
+// maxInlineD is the largest number of units inserted and removed
+// for which InlineDiff looks for a minimal diff.
+// Beyond that, everything between the common prefix and suffix
+// is reported as changed, which keeps the time and space bounded
+// for long lines that have little in common.
+const maxInlineD = 2000
+
+// InlineDiff returns a minimal diff of the single lines old and new,
+// compared in units of the given granularity, as a sequence of edits.
+// Concatenating the InlineEqual and InlineDelete edits gives old,
+// and concatenating the InlineEqual and InlineInsert edits gives new.
+// Within a changed region, deletions come before insertions.
+//
+// InlineDiff is meant for showing which part of a long line changed,
+// after Diff has reported the whole line as changed.
+func InlineDiff(old, new string, granularity Granularity) []InlineEdit {
+	x := split(old, granularity)
+	y := split(new, granularity)
+
+	matches, ok := myers(x, y, maxInlineD)
+	if !ok {
+		prefix, suffix := commonPrefixSuffix(x, y)
+		matches = nil
+		for i := 0; i < prefix; i++ {
+			matches = append(matches, pair{i, i})
+		}
+		for i := suffix; i > 0; i-- {
+			matches = append(matches, pair{len(x) - i, len(y) - i})
+		}
+	}
+
+	var edits []InlineEdit
+	add := func(op InlineOp, units []string) {
+		if len(units) == 0 {
+			return
+		}
+		text := strings.Join(units, "")
+		if n := len(edits); n > 0 && edits[n-1].Op == op {
+			edits[n-1].Text += text
+			return
+		}
+		edits = append(edits, InlineEdit{op, text})
+	}
+	var done pair
+	for _, m := range append(matches, pair{len(x), len(y)}) {
+		add(InlineDelete, x[done.x:m.x])
+		add(InlineInsert, y[done.y:m.y])
+		if m.x < len(x) {
+			add(InlineEqual, x[m.x:m.x+1])
+		}
+		done = pair{m.x + 1, m.y + 1}
+	}
+	return edits
+}
+
+// InlineSpans returns the spans of old and new
+// which are deleted and inserted by the edits.
+func InlineSpans(edits []InlineEdit) (oldSpans, newSpans []Span) {
+	var x, y int
+	for _, e := range edits {
+		switch e.Op {
+		case InlineEqual:
+			x += len(e.Text)
+			y += len(e.Text)
+		case InlineDelete:
+			oldSpans = append(oldSpans, Span{x, x + len(e.Text)})
+			x += len(e.Text)
+		case InlineInsert:
+			newSpans = append(newSpans, Span{y, y + len(e.Text)})
+			y += len(e.Text)
+		}
+	}
+	return oldSpans, newSpans
+}
+
+// InlineMarkers returns the edits as a single line of text,
+// with deleted text marked as [-text-] and inserted text as {+text+},
+// as in the output of wdiff and git diff --word-diff.
+func InlineMarkers(edits []InlineEdit) string {
+	var b strings.Builder
+	for _, e := range edits {
+		switch e.Op {
+		case InlineEqual:
+			b.WriteString(e.Text)
+		case InlineDelete:
+			b.WriteString("[-" + e.Text + "-]")
+		case InlineInsert:
+			b.WriteString("{+" + e.Text + "+}")
+		}
+	}
+	return b.String()
+}
+
+// split returns the units of s for the given granularity.
+func split(s string, granularity Granularity) []string {
+	var units []string
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		if granularity == Words {
+			class := runeClass(r)
+			for class != 0 && n < len(s) {
+				r1, n1 := utf8.DecodeRuneInString(s[n:])
+				if runeClass(r1) != class {
+					break
+				}
+				n += n1
+			}
+		}
+		units = append(units, s[:n])
+		s = s[n:]
+	}
+	return units
+}
+
+// runeClass returns 1 for letters and digits, 2 for spaces,
+// and 0 for anything else, which is a unit by itself.
+func runeClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+		return 1
+	case unicode.IsSpace(r):
+		return 2
+	}
+	return 0
+}
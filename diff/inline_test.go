@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var inlineTests = []struct {
+	old, new    string
+	granularity Granularity
+	markers     string
+	oldSpans    []Span
+	newSpans    []Span
+}{
+	{"same", "same", Chars, "same", nil, nil},
+	{"", "new", Words, "{+new+}", nil, []Span{{0, 3}}},
+	{"old", "", Words, "[-old-]", []Span{{0, 3}}, nil},
+	{"Cars & Map", "Cars &amp; Map", Words, "Cars &{+amp;+} Map", nil, []Span{{6, 10}}},
+	{"Cars & Map", "Cars &amp; Map", Chars, "Cars &{+amp;+} Map", nil, []Span{{6, 10}}},
+	{"the quick brown fox", "the quack brown box", Words,
+		"the [-quick-]{+quack+} brown [-fox-]{+box+}", []Span{{4, 9}, {16, 19}}, []Span{{4, 9}, {16, 19}}},
+	{"the quick brown fox", "the quack brown box", Chars,
+		"the qu[-i-]{+a+}ck brown [-f-]{+b+}ox", []Span{{6, 7}, {16, 17}}, []Span{{6, 7}, {16, 17}}},
+	{"1947-1950", "1947", Words, "1947[--1950-]", []Span{{4, 9}}, nil},
+	{"café crème", "café creme", Chars, "café cr[-è-]{+e+}me", []Span{{8, 10}}, []Span{{8, 9}}},
+}
+
+func TestInlineDiff(t *testing.T) {
+	for _, tt := range inlineTests {
+		edits := InlineDiff(tt.old, tt.new, tt.granularity)
+		if markers := InlineMarkers(edits); markers != tt.markers {
+			t.Errorf("InlineDiff(%q, %q, %d): markers %q, want %q", tt.old, tt.new, tt.granularity, markers, tt.markers)
+		}
+		oldSpans, newSpans := InlineSpans(edits)
+		if !reflect.DeepEqual(oldSpans, tt.oldSpans) || !reflect.DeepEqual(newSpans, tt.newSpans) {
+			t.Errorf("InlineDiff(%q, %q, %d): spans %v %v, want %v %v", tt.old, tt.new, tt.granularity,
+				oldSpans, newSpans, tt.oldSpans, tt.newSpans)
+		}
+	}
+}
+
+// Long lines with little in common fall back to a single changed region
+// between the common prefix and suffix.
+func TestInlineDiffLimit(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	old := "<x" + randomText(r, 3*maxInlineD) + "x>"
+	new := "<y" + randomText(r, 3*maxInlineD) + "y>"
+	edits := InlineDiff(old, new, Chars)
+	want := []InlineEdit{{InlineEqual, "<"}, {InlineDelete, old[1 : len(old)-1]}, {InlineInsert, new[1 : len(new)-1]}, {InlineEqual, ">"}}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("InlineDiff of unrelated long lines: got %d edits, want %d", len(edits), len(want))
+	}
+}
+
+// myers must find a common subsequence as long as the one found by
+// the textbook dynamic programming algorithm.
+func TestMyers(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		x := strings.Split(randomText(r, r.Intn(20)), "")
+		y := strings.Split(randomText(r, r.Intn(20)), "")
+		matches, ok := myers(x, y, -1)
+		if !ok {
+			t.Fatalf("myers(%q, %q) gave up with no limit", x, y)
+		}
+		last := pair{-1, -1}
+		for _, m := range matches {
+			if m.x <= last.x || m.y <= last.y || x[m.x] != y[m.y] {
+				t.Fatalf("myers(%q, %q) = %v: not a common subsequence", x, y, matches)
+			}
+			last = m
+		}
+		if want := lcsLength(x, y); len(matches) != want {
+			t.Fatalf("myers(%q, %q) = %v: length %d, want %d", x, y, matches, len(matches), want)
+		}
+	}
+}
+
+func lcsLength(x, y []string) int {
+	l := make([][]int, len(x)+1)
+	for i := range l {
+		l[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else {
+				l[i][j] = max(l[i+1][j], l[i][j+1])
+			}
+		}
+	}
+	return l[0][0]
+}
+
+func randomText(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = "abc"[r.Intn(3)]
+	}
+	return string(b)
+}
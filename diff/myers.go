@@ -0,0 +1,120 @@
+package diff
+
+// myers returns the pairs of indexes of a longest common subsequence of x and y,
+// in increasing order, found with the O(ND) algorithm described in
+// Eugene W. Myers, “An O(ND) Difference Algorithm and Its Variations,”
+// Algorithmica 1 (1986), available at http://www.xmailserver.org/diff2.pdf.
+// Unlike tgs, it finds a minimal diff: every line can be a match, not just the
+// unique ones.
+//
+// The search takes time and space quadratic in the number of lines inserted and
+// removed. If that number exceeds maxD, myers gives up and returns ok == false.
+// A negative maxD means no limit.
+func myers(x, y []string, maxD int) (matches []pair, ok bool) {
+	// Lines in a common prefix or suffix are always matched,
+	// so leave them out of the search.
+	prefix, suffix := commonPrefixSuffix(x, y)
+	for i := 0; i < prefix; i++ {
+		matches = append(matches, pair{i, i})
+	}
+	mid, ok := myersSearch(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix], maxD)
+	if !ok {
+		return nil, false
+	}
+	for _, m := range mid {
+		matches = append(matches, pair{prefix + m.x, prefix + m.y})
+	}
+	for i := suffix; i > 0; i-- {
+		matches = append(matches, pair{len(x) - i, len(y) - i})
+	}
+	return matches, true
+}
+
+// commonPrefixSuffix returns the number of lines in the longest common prefix
+// and the longest common suffix of x and y, which do not overlap.
+func commonPrefixSuffix(x, y []string) (prefix, suffix int) {
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+func myersSearch(x, y []string, maxD int) ([]pair, bool) {
+	n, m := len(x), len(y)
+
+	// v[max+k] is the furthest x reached on diagonal k = x-y.
+	// trace[d] is a copy of v[max-d:max+d+1] after step d,
+	// for walking back along the path once the end is reached.
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	D := -1
+Search:
+	for d := 0; d <= max; d++ {
+		if maxD >= 0 && d > maxD {
+			return nil, false
+		}
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				i = v[max+k+1] // step down: insert y[i-k-1]
+			} else {
+				i = v[max+k-1] + 1 // step right: delete x[i-1]
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[max+k] = i
+			if i >= n && j >= m {
+				D = d
+				break Search
+			}
+		}
+		trace = append(trace, append([]int(nil), v[max-d:max+d+1]...))
+	}
+
+	// Walk back from {n, m}, collecting the diagonal runs.
+	var rev []pair
+	i, j := n, m
+	for d := D; d > 0; d-- {
+		prev := trace[d-1] // prev[k+d-1] is the furthest x on diagonal k after step d-1
+		k := i - j
+		var pk int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		pi := prev[pk+d-1]
+		pj := pi - pk
+		// The snake after the edit runs from the end of the edit to {i, j}.
+		si, sj := pi, pj
+		if pk == k+1 {
+			sj++
+		} else {
+			si++
+		}
+		for i > si && j > sj {
+			i--
+			j--
+			rev = append(rev, pair{i, j})
+		}
+		i, j = pi, pj
+	}
+	for i > 0 && j > 0 {
+		i--
+		j--
+		rev = append(rev, pair{i, j})
+	}
+
+	matches := make([]pair, len(rev))
+	for k, p := range rev {
+		matches[len(rev)-1-k] = p
+	}
+	return matches, true
+}
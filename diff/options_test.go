@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var optionsTests = []struct {
+	name string
+	old  string
+	new  string
+	opts Options
+	want string
+}{
+	{
+		name: "no context",
+		old:  "a\nb\nc\nd\ne\n",
+		new:  "a\nB\nc\nD\ne\n",
+		opts: Options{OmitHeader: true},
+		want: "@@ -2,1 +2,1 @@\n-b\n+B\n@@ -4,1 +4,1 @@\n-d\n+D\n",
+	},
+	{
+		name: "one line of context merges changes two lines apart",
+		old:  "a\nb\nc\nd\ne\n",
+		new:  "a\nB\nc\nD\ne\n",
+		opts: Options{Context: 1, OmitHeader: true},
+		want: "@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n-d\n+D\n e\n",
+	},
+	{
+		name: "whole file",
+		old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+		new:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+		opts: Options{WholeFile: true, OmitHeader: true},
+		want: "@@ -1,9 +1,9 @@\n 1\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n 9\n",
+	},
+	{
+		name: "labels",
+		old:  "a\n",
+		new:  "b\n",
+		opts: Options{OldLabel: "golden [PRETTIFIED]", NewLabel: "actual [PRETTIFIED]"},
+		want: "diff old new\n--- golden [PRETTIFIED]\n+++ actual [PRETTIFIED]\n@@ -1,1 +1,1 @@\n-a\n+b\n",
+	},
+	{
+		name: "blank lines only",
+		old:  "a\nb\n",
+		new:  "a\n \nb\n",
+		opts: Options{Context: 3, IgnoreBlankLines: true},
+		want: "",
+	},
+	{
+		name: "blank line within the context of another change",
+		old:  "a\nb\nc\n",
+		new:  "a\n\nb\nC\n",
+		opts: Options{Context: 3, OmitHeader: true, IgnoreBlankLines: true},
+		want: "@@ -1,3 +1,4 @@\n a\n+\n b\n-c\n+C\n",
+	},
+	{
+		name: "regexp",
+		old:  "<doc>\n<field name=\"timestamp\">1</field>\n<field name=\"ead_ssi\">e</field>\n<field name=\"id\">a</field>\n</doc>\n",
+		new:  "<doc>\n<field name=\"timestamp\">2</field>\n<field name=\"ead_ssi\">e</field>\n<field name=\"id\">b</field>\n</doc>\n",
+		opts: Options{OmitHeader: true, IgnoreLines: regexp.MustCompile(`name="timestamp"`)},
+		want: "@@ -4,1 +4,1 @@\n-<field name=\"id\">a</field>\n+<field name=\"id\">b</field>\n",
+	},
+}
+
+func TestDiffWithOptions(t *testing.T) {
+	for _, tt := range optionsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			have := string(DiffWithOptions("old", []byte(tt.old), "new", []byte(tt.new), tt.opts))
+			if have != tt.want {
+				t.Fatalf("have:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
+
+// Prettified Solr docs in which most lines repeat.
+const (
+	repetitiveOld = "<add>\n<doc>\n<field name=\"subject_teim\">Men</field>\n</doc>\n<doc>\n<field name=\"subject_teim\">Men</field>\n</doc>\n</add>\n"
+	repetitiveNew = "<add>\n<doc>\n<field name=\"subject_teim\">Women</field>\n</doc>\n<doc>\n<field name=\"subject_teim\">Boys</field>\n</doc>\n</add>\n"
+)
+
+const minimalDiff = "@@ -3,1 +3,1 @@\n-<field name=\"subject_teim\">Men</field>\n+<field name=\"subject_teim\">Women</field>\n" +
+	"@@ -6,1 +6,1 @@\n-<field name=\"subject_teim\">Men</field>\n+<field name=\"subject_teim\">Boys</field>\n"
+
+var algorithmTests = []struct {
+	name      string
+	algorithm Algorithm
+	want      string
+}{
+	{"anchored", Anchored, "@@ -3,4 +3,4 @@\n" +
+		"-<field name=\"subject_teim\">Men</field>\n-</doc>\n-<doc>\n-<field name=\"subject_teim\">Men</field>\n" +
+		"+<field name=\"subject_teim\">Women</field>\n+</doc>\n+<doc>\n+<field name=\"subject_teim\">Boys</field>\n"},
+	{"minimal", Minimal, minimalDiff},
+	{"auto", Auto, minimalDiff},
+}
+
+func TestAlgorithm(t *testing.T) {
+	for _, tt := range algorithmTests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{OmitHeader: true, Algorithm: tt.algorithm}
+			have := string(DiffWithOptions("old", []byte(repetitiveOld), "new", []byte(repetitiveNew), opts))
+			if have != tt.want {
+				t.Fatalf("have:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
+
+// Every algorithm must give an edit script which turns old into new,
+// and Minimal must insert and remove no more lines than necessary.
+func TestAlgorithmEditScript(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		old := randomLines(r, r.Intn(30))
+		new := randomLines(r, r.Intn(30))
+		for _, algorithm := range []Algorithm{Auto, Anchored, Minimal} {
+			result := Structured([]byte(old), []byte(new), Options{Algorithm: algorithm})
+			var x, y strings.Builder
+			for _, e := range result.Edits {
+				if e.Op != Insert {
+					x.WriteString(e.Line)
+				}
+				if e.Op != Delete {
+					y.WriteString(e.Line)
+				}
+			}
+			if old != new && (x.String() != old || y.String() != new) {
+				t.Fatalf("Structured(%q, %q, %d): edit script gives %q, %q", old, new, algorithm, x.String(), y.String())
+			}
+			if algorithm == Minimal {
+				deleted, inserted := result.Counts()
+				xl, yl := lines([]byte(old)), lines([]byte(new))
+				if want := len(xl) + len(yl) - 2*lcsLength(xl, yl); deleted+inserted != want {
+					t.Fatalf("Structured(%q, %q, Minimal): %d lines changed, want %d", old, new, deleted+inserted, want)
+				}
+			}
+		}
+	}
+}
+
+func randomLines(r *rand.Rand, n int) string {
+	var b strings.Builder
+	for range n {
+		b.WriteString(randomText(r, 1) + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStructured(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\n"
+
+	r := Structured([]byte(old), []byte(new), Options{Context: 1})
+	if deleted, inserted := r.Counts(); deleted != 2 || inserted != 1 {
+		t.Errorf("Counts() = %d, %d, want 2, 1", deleted, inserted)
+	}
+
+	want := []Hunk{
+		{OldStart: 0, OldLines: 3, NewStart: 0, NewLines: 3, Edits: []Edit{
+			{Equal, 0, 0, "a\n"},
+			{Delete, 1, 1, "b\n"},
+			{Insert, 2, 1, "B\n"},
+			{Equal, 2, 2, "c\n"},
+		}},
+		{OldStart: 7, OldLines: 2, NewStart: 7, NewLines: 1, Edits: []Edit{
+			{Equal, 7, 7, "h\n"},
+			{Delete, 8, 8, "i\n"},
+		}},
+	}
+	if !reflect.DeepEqual(r.Hunks, want) {
+		t.Errorf("Hunks:\nhave %+v\nwant %+v", r.Hunks, want)
+	}
+
+	unified := string(r.Unified("old", "new", Options{OmitHeader: true}))
+	wantUnified := "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -8,2 +8,1 @@\n h\n-i\n"
+	if unified != wantUnified {
+		t.Errorf("Unified:\nhave:\n%s\nwant:\n%s", unified, wantUnified)
+	}
+}
+
+func TestStructuredIdentical(t *testing.T) {
+	r := Structured([]byte("a\n"), []byte("a\n"), Options{Context: DefaultContext})
+	if len(r.Edits) != 0 || len(r.Hunks) != 0 || r.Unified("old", "new", Options{}) != nil {
+		t.Errorf("Structured of identical texts = %+v, want empty result", r)
+	}
+}
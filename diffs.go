@@ -0,0 +1,108 @@
+package main
+
+import (
+	"dlfa_250_set_up_all_ead_test_for_go_ead_indexer_package/diff"
+	"fmt"
+	"github.com/nyulibraries/go-ead-indexer/pkg/ead/eadutil"
+	"regexp"
+	"strings"
+)
+
+// `diff.Auto` falls back to a minimal diff when there are too few unique lines
+// to anchor one, which is the case for prettified docs with many repeated
+// field values.  A purely anchored diff of those is one big hunk.
+var defaultDiffOptions = diff.Options{Algorithm: diff.Auto, Context: diff.DefaultContext}
+
+// The options for the diff files, `show`, and the massage diffs.  Set by
+// `setDiffOptions`.
+var diffOptions = defaultDiffOptions
+
+// The regexps in `diffOptions.IgnoreLines`, as given, for the input hashes.
+var diffIgnoreLines []string
+
+// The size of a mismatch, from the diff of the prettified values.  The line
+// counts are for the whole edit script, so they include changes left out of
+// the diff file by `diff_ignore_lines`.  `Hunks` are the ones in the diff file.
+type diffStats struct {
+	Hunks         int `json:"hunks"`
+	LinesDeleted  int `json:"lines_deleted"`
+	LinesInserted int `json:"lines_inserted"`
+}
+
+func (stats diffStats) String() string {
+	return fmt.Sprintf("lines deleted: %d, inserted: %d, hunks: %d", stats.LinesDeleted, stats.LinesInserted,
+		stats.Hunks)
+}
+
+// Diffs the values after prettifying them, which puts each field on a line of
+// its own.
+func diffPrettified(oldLabel string, oldValue string, newLabel string, newValue string) string {
+	return string(diff.DiffWithOptions(oldLabel+" [PRETTIFIED]", []byte(eadutil.PrettifySolrAddMessageXML(oldValue)),
+		newLabel+" [PRETTIFIED]", []byte(eadutil.PrettifySolrAddMessageXML(newValue)), diffOptions))
+}
+
+// Like `diffPrettified`, but also returns the stats for the mismatch report.
+// The diff is written from the same structured result the stats come from.
+func diffPrettifiedWithStats(oldLabel string, oldValue string, newLabel string,
+	newValue string) (string, diffStats) {
+
+	result := diff.Structured([]byte(eadutil.PrettifySolrAddMessageXML(oldValue)),
+		[]byte(eadutil.PrettifySolrAddMessageXML(newValue)), diffOptions)
+	deleted, inserted := result.Counts()
+	stats := diffStats{Hunks: len(result.Hunks), LinesDeleted: deleted, LinesInserted: inserted}
+
+	return string(result.Unified(oldLabel+" [PRETTIFIED]", newLabel+" [PRETTIFIED]", diffOptions)), stats
+}
+
+// For `getDiffDescription`.
+var diffAlgorithmNames = map[diff.Algorithm]string{
+	diff.Anchored: "anchored",
+	diff.Auto:     "auto",
+	diff.Minimal:  "minimal",
+}
+
+// For the incremental run cache.  The algorithm is always included, because it
+// changes the diff stats, so results cached before the diffs were done with
+// `diff.Auto` are tested again.
+func getDiffDescription() string {
+	description := []string{"algorithm=" + diffAlgorithmNames[diffOptions.Algorithm]}
+	if diffOptions.Context != diff.DefaultContext {
+		description = append(description, fmt.Sprintf("context=%d", diffOptions.Context))
+	}
+	for _, ignoreLines := range diffIgnoreLines {
+		description = append(description, "ignore="+ignoreLines)
+	}
+
+	return strings.Join(description, " ")
+}
+
+// `context` defaults to `diff.DefaultContext` if nil.  A change in which every
+// deleted and inserted line matches one of the `ignoreLines` regexps is left
+// out of the diffs, unless it's next to another change.
+func setDiffOptions(context *int, ignoreLines []string) error {
+	options := defaultDiffOptions
+
+	if context != nil {
+		if *context < 0 {
+			return fmt.Errorf("Invalid diff context %d: must not be negative", *context)
+		}
+		options.Context = *context
+	}
+
+	patterns := []string{}
+	for _, pattern := range ignoreLines {
+		_, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf(`Invalid diff ignore lines regexp "%s": %s`, pattern, err)
+		}
+		patterns = append(patterns, "(?:"+pattern+")")
+	}
+	if len(patterns) > 0 {
+		options.IgnoreLines = regexp.MustCompile(strings.Join(patterns, "|"))
+	}
+
+	diffOptions = options
+	diffIgnoreLines = ignoreLines
+
+	return nil
+}
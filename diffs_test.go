@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetDiffOptions(t *testing.T) {
+	negative := -1
+	zero := 0
+
+	testCases := []struct {
+		name                string
+		context             *int
+		ignoreLines         []string
+		expectedDescription string
+		expectedError       string
+	}{
+		{
+			name:                "defaults",
+			expectedDescription: "algorithm=auto",
+		},
+		{
+			name:                "context and ignore lines",
+			context:             &zero,
+			ignoreLines:         []string{"timestamp", `_version_`},
+			expectedDescription: "algorithm=auto context=0 ignore=timestamp ignore=_version_",
+		},
+		{
+			name:          "negative context",
+			context:       &negative,
+			expectedError: "Invalid diff context -1: must not be negative",
+		},
+		{
+			name:          "invalid regexp",
+			ignoreLines:   []string{"("},
+			expectedError: `Invalid diff ignore lines regexp "(": `,
+		},
+	}
+
+	defer setDiffOptions(nil, nil)
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := setDiffOptions(testCase.context, testCase.ignoreLines)
+			if testCase.expectedError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error starting with %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setDiffOptions() failed: %s", err)
+			}
+			if description := getDiffDescription(); description != testCase.expectedDescription {
+				t.Errorf("expected description %q, got %q", testCase.expectedDescription, description)
+			}
+		})
+	}
+}
+
+func TestDiffPrettified(t *testing.T) {
+	const golden = `<add><doc><field name="id">a</field><field name="b_ssm">b</field><field name="c_ssm">c</field><field name="d_ssm">d</field><field name="timestamp">1</field></doc></add>`
+	const actual = `<add><doc><field name="id">a</field><field name="b_ssm">B</field><field name="c_ssm">c</field><field name="d_ssm">d</field><field name="timestamp">2</field></doc></add>`
+	zero := 0
+
+	testCases := []struct {
+		name          string
+		context       *int
+		ignoreLines   []string
+		expectedLines []string
+		// Lines which must not be in the diff.
+		unexpectedLines []string
+	}{
+		{
+			name:          "default context",
+			expectedLines: []string{"--- golden [PRETTIFIED]", "+++ actual [PRETTIFIED]", ` <field name="id">a</field>`, `-<field name="timestamp">1</field>`},
+		},
+		{
+			name:            "no context",
+			context:         &zero,
+			expectedLines:   []string{`+<field name="b_ssm">B</field>`, `+<field name="timestamp">2</field>`},
+			unexpectedLines: []string{` <field name="c_ssm">c</field>`},
+		},
+		{
+			name:            "ignore lines",
+			context:         &zero,
+			ignoreLines:     []string{`name="timestamp"`},
+			expectedLines:   []string{`+<field name="b_ssm">B</field>`},
+			unexpectedLines: []string{`+<field name="timestamp">2</field>`},
+		},
+	}
+
+	defer setDiffOptions(nil, nil)
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := setDiffOptions(testCase.context, testCase.ignoreLines)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Strip the indentation added by prettifying.
+			diffLines := []string{}
+			for _, line := range strings.Split(diffPrettified("golden", golden, "actual", actual), "\n") {
+				if len(line) > 0 {
+					line = line[:1] + strings.TrimSpace(line[1:])
+				}
+				diffLines = append(diffLines, line)
+			}
+			diff := strings.Join(diffLines, "\n")
+			for _, line := range testCase.expectedLines {
+				if !strings.Contains(diff, line+"\n") {
+					t.Errorf("expected the diff to contain %q, got:\n%s", line, diff)
+				}
+			}
+			for _, line := range testCase.unexpectedLines {
+				if strings.Contains(diff, line+"\n") {
+					t.Errorf("expected the diff not to contain %q, got:\n%s", line, diff)
+				}
+			}
+		})
+	}
+}
+
+// The diff options are used for the diff files.
+func TestTestSingleEADDiffOptions(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	breakGoldenFile(t, testEAD, testdataMismatchFileID)
+	err := setDiffOptions(nil, []string{`name="unittitle_ssm"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := testSingleEAD(testEAD)
+	if output.result.Counts.Mismatched != 1 {
+		t.Fatalf("expected the ignored change to still be a mismatch, got %+v: %s", output.result.Counts,
+			output.stderr.String())
+	}
+	diff, err := os.ReadFile(diffFile(testEAD, testdataMismatchFileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("expected an empty diff file, got:\n%s", diff)
+	}
+}
+
+// The size of each mismatch is recorded in the result and counted.
+func TestTestSingleEADMismatchDiffStats(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	breakGoldenFile(t, testEAD, testdataMismatchFileID)
+
+	output := testSingleEAD(testEAD)
+	expected := diffStats{Hunks: 1, LinesDeleted: 1, LinesInserted: 1}
+	if stats := output.result.MismatchDiffs[testdataMismatchFileID]; stats != expected {
+		t.Errorf("expected diff stats %+v, got %+v: %s", expected, output.result.MismatchDiffs,
+			output.stderr.String())
+	}
+	if output.result.Counts.MismatchedLinesDeleted != 1 || output.result.Counts.MismatchedLinesInserted != 1 {
+		t.Errorf("expected 1 line deleted and 1 inserted, got %+v", output.result.Counts)
+	}
+	if !strings.Contains(output.stderr.String(), "do not match ("+expected.String()+")") {
+		t.Errorf("expected the diff stats in the mismatch message, got %q", output.stderr.String())
+	}
+}
+
+// A mismatch in a doc which repeats most of its field values is diffed field
+// by field, not as one hunk from the first change to the last.
+func TestTestSolrAddMessageXMLRepetitiveDocDiff(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	makeDoc := func(changed bool) string {
+		fields := []string{`<field name="id">` + testdataMismatchFileID + `</field>`}
+		// Every field is repeated three times, so none of them anchor the diff.
+		for i := range 30 {
+			value := fmt.Sprintf("value %d", i%10)
+			if changed && (i == 3 || i == 26) {
+				value = "changed"
+			}
+			fields = append(fields, `<field name="subject_ssm">`+value+`</field>`)
+		}
+		return `<?xml version="1.0" encoding="UTF-8"?><add><doc>` + strings.Join(fields, "") + `</doc></add>`
+	}
+	golden := makeDoc(false)
+	capture := makeTestGoldenCapture("POST /solr/findingaids/update?wt=ruby HTTP/1.1", "text/xml; charset=utf-8",
+		len(golden), golden)
+	err := os.WriteFile(getGoldenFilePath(testEAD, testdataMismatchFileID), []byte(capture), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = testSolrAddMessageXML(testEAD, testdataMismatchFileID, makeDoc(true))
+	mismatch := mismatchError{}
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a mismatch, got %v", err)
+	}
+	expected := diffStats{Hunks: 2, LinesDeleted: 2, LinesInserted: 2}
+	if mismatch.stats != expected {
+		t.Errorf("expected diff stats %+v, got %+v", expected, mismatch.stats)
+	}
+
+	diff, err := os.ReadFile(diffFile(testEAD, testdataMismatchFileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := strings.Split(string(diff), "\n@@ ")[1:]
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got:\n%s", diff)
+	}
+	for _, hunk := range hunks {
+		if strings.Count(hunk, "\n-") != 1 || strings.Count(hunk, "\n+") != 1 ||
+			!strings.Contains(hunk, "+    <field name=\"subject_ssm\">changed</field>") {
+			t.Errorf("expected a hunk with only the changed field, got:\n%s", hunk)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"dlfa_250_set_up_all_ead_test_for_go_ead_indexer_package/diff"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The field diff files are written next to the diff file of each mismatch.
+const fieldDiffJSONFileSuffix = "-fields.json"
+const fieldDiffTextFileSuffix = "-fields.txt"
+
+// Values for `fieldChange.Kind`.  "added" and "removed" are for fields which
+// are only in the actual value or only in the golden value.  "value_changed" is
+// for a field which has the same number of values in both, but a different
+// value at `Index`.  "multiplicity_changed" is for a field which has a different
+// number of values.
+const (
+	fieldChangeAdded               = "added"
+	fieldChangeMultiplicityChanged = "multiplicity_changed"
+	fieldChangeRemoved             = "removed"
+	fieldChangeValueChanged        = "value_changed"
+)
+
+// A field-level difference between the golden and actual Solr add messages.
+// `Doc` and `Index` are 0-based.  Values are shown with XML entities decoded
+// and whitespace collapsed, as they are compared in "structural" comparison,
+// and with any attributes and child elements: see `getFieldDisplayValue`.
+type fieldChange struct {
+	// Only for "value_changed": the parts of the actual value which are not in
+	// the golden value.
+	ActualSpans  []valueSpan `json:"actual_spans,omitempty"`
+	ActualValues []string    `json:"actual_values"`
+	Doc          int         `json:"doc"`
+	Field        string      `json:"field"`
+	// Only for "value_changed": the parts of the golden value which are not in
+	// the actual value.
+	GoldenSpans  []valueSpan `json:"golden_spans,omitempty"`
+	GoldenValues []string    `json:"golden_values"`
+	// Only for "value_changed".
+	Index *int   `json:"index,omitempty"`
+	Kind  string `json:"kind"`
+	// Only for "value_changed": the word diff of the golden and actual values,
+	// with [-deleted-] and {+inserted+} markers.
+	Markers string `json:"markers,omitempty"`
+}
+
+// Byte offsets into a value, with `End` exclusive.
+type valueSpan struct {
+	End   int `json:"end"`
+	Start int `json:"start"`
+}
+
+type fieldDiffReport struct {
+	Changes []fieldChange `json:"changes"`
+	FileID  string        `json:"file_id"`
+	TestEAD string        `json:"test_ead"`
+}
+
+func fieldDiffJSONFile(testEAD string, fileID string) string {
+	return filepath.Join(diffsDirPath, testEAD, fileID+fieldDiffJSONFileSuffix)
+}
+
+func fieldDiffTextFile(testEAD string, fileID string) string {
+	return filepath.Join(diffsDirPath, testEAD, fileID+fieldDiffTextFileSuffix)
+}
+
+func getFieldChanges(doc int, golden solrDoc, actual solrDoc) []fieldChange {
+	changes := []fieldChange{}
+
+	goldenKeys, goldenFieldNames := groupFieldValues(golden.Fields)
+	actualKeys, actualFieldNames := groupFieldValues(actual.Fields)
+	goldenValues := groupDisplayValues(golden.Fields)
+	actualValues := groupDisplayValues(actual.Fields)
+
+	for _, fieldName := range goldenFieldNames {
+		_, inActual := actualKeys[fieldName]
+		switch {
+		case !inActual:
+			changes = append(changes, fieldChange{ActualValues: []string{}, Doc: doc, Field: fieldName,
+				GoldenValues: goldenValues[fieldName], Kind: fieldChangeRemoved})
+		case fieldValuesMatch(goldenKeys[fieldName], actualKeys[fieldName], getFieldSemantics(fieldName)):
+		case len(goldenKeys[fieldName]) != len(actualKeys[fieldName]):
+			changes = append(changes, fieldChange{ActualValues: actualValues[fieldName], Doc: doc, Field: fieldName,
+				GoldenValues: goldenValues[fieldName], Kind: fieldChangeMultiplicityChanged})
+		default:
+			for index := range goldenKeys[fieldName] {
+				if goldenKeys[fieldName][index] == actualKeys[fieldName][index] {
+					continue
+				}
+				goldenValue := goldenValues[fieldName][index]
+				actualValue := actualValues[fieldName][index]
+				edits := diff.InlineDiff(goldenValue, actualValue, diff.Words)
+				goldenSpans, actualSpans := diff.InlineSpans(edits)
+				changes = append(changes, fieldChange{
+					ActualSpans:  getValueSpans(actualSpans),
+					ActualValues: []string{actualValue},
+					Doc:          doc,
+					Field:        fieldName,
+					GoldenSpans:  getValueSpans(goldenSpans),
+					GoldenValues: []string{goldenValue},
+					Index:        &index,
+					Kind:         fieldChangeValueChanged,
+					Markers:      diff.InlineMarkers(edits),
+				})
+			}
+		}
+	}
+
+	for _, fieldName := range actualFieldNames {
+		if _, inGolden := goldenKeys[fieldName]; !inGolden {
+			changes = append(changes, fieldChange{ActualValues: actualValues[fieldName], Doc: doc, Field: fieldName,
+				GoldenValues: []string{}, Kind: fieldChangeAdded})
+		}
+	}
+
+	return changes
+}
+
+// Fields whose values match according to their semantics are left out, as are
+// differences in field order: see `solrDocsMatch`.  Extra docs in either value
+// are compared against an empty doc.
+// Returns a `goldenFileError` if the golden value can't be parsed.  An actual
+// value which can't be parsed is a plain error.
+func getFieldDiffReport(testEAD string, fileID string, goldenValue string,
+	actualValue string) (fieldDiffReport, error) {
+	report := fieldDiffReport{Changes: []fieldChange{}, FileID: fileID, TestEAD: testEAD}
+
+	golden, err := parseSolrAddMessage(goldenValue)
+	if err != nil {
+		return report, newGoldenFileError("golden value is not a valid Solr add message: %s", err)
+	}
+	actual, err := parseSolrAddMessage(actualValue)
+	if err != nil {
+		return report, fmt.Errorf("actual value is not a valid Solr add message: %s", err)
+	}
+
+	for i := range max(len(golden.Docs), len(actual.Docs)) {
+		goldenDoc := solrDoc{}
+		if i < len(golden.Docs) {
+			goldenDoc = golden.Docs[i]
+		}
+		actualDoc := solrDoc{}
+		if i < len(actual.Docs) {
+			actualDoc = actual.Docs[i]
+		}
+		report.Changes = append(report.Changes, getFieldChanges(i, goldenDoc, actualDoc)...)
+	}
+
+	return report, nil
+}
+
+func getFieldDiffText(report fieldDiffReport) string {
+	text := strings.Builder{}
+	fmt.Fprintf(&text, "Field changes from golden to actual for %s/%s\n", report.TestEAD, report.FileID)
+	if len(report.Changes) == 0 {
+		text.WriteString("\nNo field-level changes: the golden and actual values differ only in serialization or field order.\n")
+		return text.String()
+	}
+
+	for i, change := range report.Changes {
+		if i == 0 || change.Doc != report.Changes[i-1].Doc {
+			fmt.Fprintf(&text, "\ndoc %d:\n", change.Doc)
+		}
+		switch change.Kind {
+		case fieldChangeValueChanged:
+			fmt.Fprintf(&text, "  %s: value changed at index %d\n", change.Field, *change.Index)
+		case fieldChangeMultiplicityChanged:
+			fmt.Fprintf(&text, "  %s: multiplicity changed from %d to %d\n", change.Field,
+				len(change.GoldenValues), len(change.ActualValues))
+		default:
+			fmt.Fprintf(&text, "  %s: %s\n", change.Field, change.Kind)
+		}
+		for _, value := range change.GoldenValues {
+			fmt.Fprintf(&text, "    golden: %s\n", value)
+		}
+		for _, value := range change.ActualValues {
+			fmt.Fprintf(&text, "    actual: %s\n", value)
+		}
+		if change.Markers != "" {
+			fmt.Fprintf(&text, "    change: %s\n", change.Markers)
+		}
+	}
+
+	return text.String()
+}
+
+func getValueSpans(spans []diff.Span) []valueSpan {
+	valueSpans := []valueSpan{}
+	for _, span := range spans {
+		valueSpans = append(valueSpans, valueSpan{End: span.End, Start: span.Start})
+	}
+
+	return valueSpans
+}
+
+// Shows everything that `getFieldValueKey` compares, so that a change to only
+// the attributes or child elements of a field is visible: the attributes are
+// appended to the value as ` [@name="value"]`, in the same order, and the child
+// elements as ` [<name>]`.
+func getFieldDisplayValue(field solrField) string {
+	value := strings.Builder{}
+	value.WriteString(normalizeFieldValue(field.Value))
+	for _, attr := range slices.SortedFunc(slices.Values(field.Attrs), compareXMLAttrs) {
+		fmt.Fprintf(&value, ` [@%s="%s"]`, getXMLNameDisplay(attr.Name), attr.Value)
+	}
+	for _, other := range field.Other {
+		fmt.Fprintf(&value, " [<%s>]", getXMLNameDisplay(other.XMLName))
+	}
+
+	return value.String()
+}
+
+func getXMLNameDisplay(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return fmt.Sprintf("{%s}%s", name.Space, name.Local)
+}
+
+func groupDisplayValues(fields []solrField) map[string][]string {
+	values := map[string][]string{}
+	for _, field := range fields {
+		values[field.Name] = append(values[field.Name], getFieldDisplayValue(field))
+	}
+
+	return values
+}
+
+func writeFieldDiffFiles(report fieldDiffReport) error {
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return guardedWrite(report.TestEAD, func() error {
+		jsonFile := fieldDiffJSONFile(report.TestEAD, report.FileID)
+		err := os.MkdirAll(filepath.Dir(jsonFile), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(jsonFile, bytes, 0644)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(fieldDiffTextFile(report.TestEAD, report.FileID), []byte(getFieldDiffText(report)), 0644)
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetFieldDiffReport(t *testing.T) {
+	const golden = `<add><doc><field name="id">a</field><field name="title_ssm">Cars &amp; Map</field><field name="subject_teim">x</field><field name="subject_teim">y</field><field name="creator_ssm">c</field></doc></add>`
+	const actual = `<add><doc><field name="id">a</field><field name="title_ssm">Cars &amp;amp; Map</field><field name="subject_teim">x</field><field name="genre_ssm">g</field></doc></add>`
+
+	report, err := getFieldDiffReport("edip/mos_2024", "mos_2024", golden, actual)
+	if err != nil {
+		t.Fatalf("getFieldDiffReport() failed: %s", err)
+	}
+
+	index := 0
+	expectedChanges := []fieldChange{
+		{ActualValues: []string{"Cars &amp; Map"}, Field: "title_ssm", GoldenValues: []string{"Cars & Map"},
+			Index: &index, Kind: fieldChangeValueChanged},
+		{ActualValues: []string{"x"}, Field: "subject_teim", GoldenValues: []string{"x", "y"},
+			Kind: fieldChangeMultiplicityChanged},
+		{ActualValues: []string{}, Field: "creator_ssm", GoldenValues: []string{"c"}, Kind: fieldChangeRemoved},
+		{ActualValues: []string{"g"}, Field: "genre_ssm", GoldenValues: []string{}, Kind: fieldChangeAdded},
+	}
+	if !slices.EqualFunc(report.Changes, expectedChanges, func(a fieldChange, b fieldChange) bool {
+		return a.Doc == b.Doc && a.Field == b.Field && a.Kind == b.Kind &&
+			slices.Equal(a.ActualValues, b.ActualValues) && slices.Equal(a.GoldenValues, b.GoldenValues) &&
+			(a.Index == nil) == (b.Index == nil) && (a.Index == nil || *a.Index == *b.Index)
+	}) {
+		t.Errorf("expected changes %+v, got %+v", expectedChanges, report.Changes)
+	}
+
+	valueChange := report.Changes[0]
+	if valueChange.Markers != "Cars &{+amp;+} Map" {
+		t.Errorf(`expected markers "Cars &{+amp;+} Map", got %q`, valueChange.Markers)
+	}
+	if len(valueChange.GoldenSpans) != 0 ||
+		!slices.Equal(valueChange.ActualSpans, []valueSpan{{End: 10, Start: 6}}) {
+		t.Errorf("expected no golden spans and actual spans [{10 6}], got %v and %v",
+			valueChange.GoldenSpans, valueChange.ActualSpans)
+	}
+}
+
+// A change to only the attributes of a field is shown in its values.
+func TestGetFieldDiffReportAttributes(t *testing.T) {
+	const golden = `<add><doc><field name="id">a</field><field name="title_ssm" type="a">T</field></doc></add>`
+	const actual = `<add><doc><field name="id">a</field><field name="title_ssm" type="b">T</field></doc></add>`
+
+	report, err := getFieldDiffReport("edip/mos_2024", "mos_2024", golden, actual)
+	if err != nil {
+		t.Fatalf("getFieldDiffReport() failed: %s", err)
+	}
+	if len(report.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", report.Changes)
+	}
+	change := report.Changes[0]
+	if !slices.Equal(change.GoldenValues, []string{`T [@type="a"]`}) ||
+		!slices.Equal(change.ActualValues, []string{`T [@type="b"]`}) {
+		t.Errorf(`expected golden [T [@type="a"]] and actual [T [@type="b"]], got %q and %q`,
+			change.GoldenValues, change.ActualValues)
+	}
+	if change.Markers != `T [@type="[-a-]{+b+}"]` {
+		t.Errorf("expected the attribute change in the markers, got %q", change.Markers)
+	}
+}
+
+// In "exact" comparison, a golden value which can't be parsed for the field diff
+// is still reported as a mismatch, not as a golden file error.
+func TestTestSingleEADFieldDiffError(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	defer setComparisonMode("")
+	err := setComparisonMode(comparisonExact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same length, so the Content-Length is still right.
+	replaceInFile(t, getGoldenFilePath(testEAD, testdataMismatchFileID), `<field name="unittitle_ssm">`,
+		`<field nome="unittitle_ssm">`)
+
+	output := testSingleEAD(testEAD)
+	if output.result.Counts.GoldenFileErrors != 0 {
+		t.Errorf("expected no golden file errors, got %d", output.result.Counts.GoldenFileErrors)
+	}
+	expected := testdataMismatchFileID + " golden and actual values do not match (lines deleted: 1, inserted: 1, " +
+		"hunks: 1) (no field diff: golden value is not a valid Solr add message: "
+	if !strings.Contains(output.stderr.String(), expected) {
+		t.Errorf("expected stderr to contain %q, got %q", expected, output.stderr.String())
+	}
+	if _, err := os.Stat(diffFile(testEAD, testdataMismatchFileID)); err != nil {
+		t.Errorf("expected a diff file: %s", err)
+	}
+	if _, err := os.Stat(fieldDiffJSONFile(testEAD, testdataMismatchFileID)); err == nil {
+		t.Errorf("expected no field diff file")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Filters for targeted runs -- e.g. only the EADs of one repository while
+// working on a bug in it.  An empty include list includes everything.  Exclude
+// lists are applied after include lists.  The component filters apply only to
+// components: the collection doc of every selected EAD is always tested.
+type filters struct {
+	// File listing the test EADs to include, one [repository code]/[EAD ID] per
+	// line.  Blank lines and lines starting with "#" are ignored.
+	EADListFile string `json:"ead_list_file"`
+	// Regular expressions, matched against the component ID.
+	ExcludeComponents []string `json:"exclude_components"`
+	// Globs, matched against the EAD ID.
+	ExcludeEADs         []string `json:"exclude_eads"`
+	ExcludeRepositories []string `json:"exclude_repositories"`
+	IncludeComponents   []string `json:"include_components"`
+	IncludeEADs         []string `json:"include_eads"`
+	IncludeRepositories []string `json:"include_repositories"`
+}
+
+// `filters` ready for matching.  A nil `eadList` means no EAD list file.
+type compiledFilters struct {
+	eadList           map[string]bool
+	excludeComponents []*regexp.Regexp
+	includeComponents []*regexp.Regexp
+	source            filters
+}
+
+// Set by `setFilters`.
+var testFilters compiledFilters
+
+// Hash of the component filters, which are one of the inputs for each test EAD
+// because they determine which components are tested.  Empty when there are no
+// component filters, so that the input hashes of unfiltered runs don't change.
+var componentFiltersHash string
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	regexps := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		compiledRegexp, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf(`Invalid component ID regexp "%s": %s`, pattern, err)
+		}
+		regexps = append(regexps, compiledRegexp)
+	}
+
+	return regexps, nil
+}
+
+func getComponentFiltersHash(componentFilters filters) (string, error) {
+	if len(componentFilters.IncludeComponents) == 0 && len(componentFilters.ExcludeComponents) == 0 {
+		return "", nil
+	}
+
+	bytes, err := json.Marshal([][]string{componentFilters.IncludeComponents, componentFilters.ExcludeComponents})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func includesComponent(componentID string) bool {
+	matchesComponentID := func(componentRegexp *regexp.Regexp) bool {
+		return componentRegexp.MatchString(componentID)
+	}
+
+	if len(testFilters.includeComponents) > 0 &&
+		!slices.ContainsFunc(testFilters.includeComponents, matchesComponentID) {
+		return false
+	}
+
+	return !slices.ContainsFunc(testFilters.excludeComponents, matchesComponentID)
+}
+
+// The globs have already been validated by `setFilters`, so errors can be
+// ignored.
+func includesTestEAD(testEAD string) bool {
+	repositoryCode := parseRepositoryCode(testEAD)
+	eadID := parseEADID(testEAD)
+	matchesEADID := func(glob string) bool {
+		matched, _ := path.Match(glob, eadID)
+		return matched
+	}
+
+	if testFilters.eadList != nil && !testFilters.eadList[testEAD] {
+		return false
+	}
+	if len(testFilters.source.IncludeRepositories) > 0 &&
+		!slices.Contains(testFilters.source.IncludeRepositories, repositoryCode) {
+		return false
+	}
+	if slices.Contains(testFilters.source.ExcludeRepositories, repositoryCode) {
+		return false
+	}
+	if len(testFilters.source.IncludeEADs) > 0 &&
+		!slices.ContainsFunc(testFilters.source.IncludeEADs, matchesEADID) {
+		return false
+	}
+
+	return !slices.ContainsFunc(testFilters.source.ExcludeEADs, matchesEADID)
+}
+
+func readEADListFile(eadListFile string) (map[string]bool, error) {
+	file, err := os.Open(eadListFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	eadList := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Count(line, "/") != 1 {
+			return nil, fmt.Errorf(`"%s" is not of the form [repository code]/[EAD ID]`, line)
+		}
+		eadList[line] = true
+	}
+
+	return eadList, scanner.Err()
+}
+
+// Applies the filters and the shard to all the test EADs in the EAD root.  It's
+// an error for the EAD list file to name EADs which aren't in the EAD root,
+// because that almost certainly means that the list is out of date or has a
+// typo.
+func selectTestEADs(allTestEADs []string) ([]string, error) {
+	missingTestEADs := []string{}
+	for testEAD := range testFilters.eadList {
+		if _, found := slices.BinarySearch(allTestEADs, testEAD); !found {
+			missingTestEADs = append(missingTestEADs, testEAD)
+		}
+	}
+	if len(missingTestEADs) > 0 {
+		slices.Sort(missingTestEADs)
+		return nil, fmt.Errorf("EAD list file \"%s\" names EADs which are not in the EAD root:\n%s",
+			testFilters.source.EADListFile, strings.Join(missingTestEADs, "\n"))
+	}
+
+	return slices.DeleteFunc(slices.Clone(allTestEADs), func(testEAD string) bool {
+		return !includesTestEAD(testEAD) || !shard.contains(testEAD)
+	}), nil
+}
+
+func setFilters(newFilters filters) error {
+	compiled := compiledFilters{source: newFilters}
+
+	for _, glob := range slices.Concat(newFilters.IncludeEADs, newFilters.ExcludeEADs) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf(`Invalid EAD ID glob "%s": %s`, glob, err)
+		}
+	}
+
+	var err error
+	compiled.includeComponents, err = compileRegexps(newFilters.IncludeComponents)
+	if err != nil {
+		return err
+	}
+	compiled.excludeComponents, err = compileRegexps(newFilters.ExcludeComponents)
+	if err != nil {
+		return err
+	}
+
+	if newFilters.EADListFile != "" {
+		compiled.eadList, err = readEADListFile(newFilters.EADListFile)
+		if err != nil {
+			return fmt.Errorf(`EAD list file "%s" could not be read: %s`, newFilters.EADListFile, err)
+		}
+	}
+
+	componentFiltersHash, err = getComponentFiltersHash(newFilters)
+	if err != nil {
+		return err
+	}
+	testFilters = compiled
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testFilterEADs = []string{"akkasah/ad_mc_007", "fales/mss_001", "fales/mss_002", "tamwag/aia_001",
+	"tamwag/mss_001"}
+
+func TestIncludesTestEAD(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  filters
+		expected []string
+	}{
+		{
+			name:     "no filters",
+			filters:  filters{},
+			expected: testFilterEADs,
+		},
+		{
+			name:     "include repositories",
+			filters:  filters{IncludeRepositories: []string{"fales", "akkasah"}},
+			expected: []string{"akkasah/ad_mc_007", "fales/mss_001", "fales/mss_002"},
+		},
+		{
+			name:     "exclude repositories",
+			filters:  filters{ExcludeRepositories: []string{"fales"}},
+			expected: []string{"akkasah/ad_mc_007", "tamwag/aia_001", "tamwag/mss_001"},
+		},
+		{
+			name:     "include EADs",
+			filters:  filters{IncludeEADs: []string{"mss_*"}},
+			expected: []string{"fales/mss_001", "fales/mss_002", "tamwag/mss_001"},
+		},
+		{
+			name:     "exclude EADs after include",
+			filters:  filters{IncludeEADs: []string{"mss_*"}, ExcludeEADs: []string{"*_002"}},
+			expected: []string{"fales/mss_001", "tamwag/mss_001"},
+		},
+		{
+			name:     "EAD globs match the EAD ID, not the repository",
+			filters:  filters{IncludeEADs: []string{"fales*"}},
+			expected: []string{},
+		},
+		{
+			name:     "repositories and EADs",
+			filters:  filters{IncludeRepositories: []string{"tamwag"}, IncludeEADs: []string{"mss_*"}},
+			expected: []string{"tamwag/mss_001"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := setFilters(testCase.filters)
+			if err != nil {
+				t.Fatalf("setFilters() failed: %s", err)
+			}
+			t.Cleanup(func() { setFilters(filters{}) })
+
+			included := slices.DeleteFunc(slices.Clone(testFilterEADs), func(testEAD string) bool {
+				return !includesTestEAD(testEAD)
+			})
+			if !slices.Equal(included, testCase.expected) {
+				t.Errorf("expected %q, got %q", testCase.expected, included)
+			}
+		})
+	}
+}
+
+func TestIncludesComponent(t *testing.T) {
+	componentIDs := []string{"mss_001aspace_ref1", "mss_001aspace_ref10", "mss_001aspace_ref2"}
+
+	testCases := []struct {
+		name     string
+		filters  filters
+		expected []string
+	}{
+		{
+			name:     "no filters",
+			filters:  filters{},
+			expected: componentIDs,
+		},
+		{
+			name:     "include",
+			filters:  filters{IncludeComponents: []string{"ref1"}},
+			expected: []string{"mss_001aspace_ref1", "mss_001aspace_ref10"},
+		},
+		{
+			name:     "include anchored",
+			filters:  filters{IncludeComponents: []string{"ref1$", "ref2$"}},
+			expected: []string{"mss_001aspace_ref1", "mss_001aspace_ref2"},
+		},
+		{
+			name:     "exclude after include",
+			filters:  filters{IncludeComponents: []string{"ref1"}, ExcludeComponents: []string{"0$"}},
+			expected: []string{"mss_001aspace_ref1"},
+		},
+		{
+			name:     "EAD filters don't apply to components",
+			filters:  filters{ExcludeEADs: []string{"*"}},
+			expected: componentIDs,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := setFilters(testCase.filters)
+			if err != nil {
+				t.Fatalf("setFilters() failed: %s", err)
+			}
+			t.Cleanup(func() { setFilters(filters{}) })
+
+			included := slices.DeleteFunc(slices.Clone(componentIDs), func(componentID string) bool {
+				return !includesComponent(componentID)
+			})
+			if !slices.Equal(included, testCase.expected) {
+				t.Errorf("expected %q, got %q", testCase.expected, included)
+			}
+		})
+	}
+}
+
+// Only the component filters change the input hashes.
+func TestGetComponentFiltersHash(t *testing.T) {
+	for _, unfiltered := range []filters{{}, {IncludeEADs: []string{"mss_*"}, ExcludeRepositories: []string{"fales"}}} {
+		hash, err := getComponentFiltersHash(unfiltered)
+		if err != nil || hash != "" {
+			t.Errorf("expected no hash for %+v, got %q, %v", unfiltered, hash, err)
+		}
+	}
+
+	includeHash, _ := getComponentFiltersHash(filters{IncludeComponents: []string{"ref1$"}})
+	excludeHash, _ := getComponentFiltersHash(filters{ExcludeComponents: []string{"ref1$"}})
+	if includeHash == "" || excludeHash == "" || includeHash == excludeHash {
+		t.Errorf("expected different hashes for include and exclude, got %q and %q", includeHash, excludeHash)
+	}
+}
+
+func TestSetFiltersErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		filters       filters
+		expectedError string
+	}{
+		{
+			name:          "invalid EAD glob",
+			filters:       filters{ExcludeEADs: []string{"mss_[0"}},
+			expectedError: `Invalid EAD ID glob "mss_[0"`,
+		},
+		{
+			name:          "invalid component regexp",
+			filters:       filters{IncludeComponents: []string{"ref(1"}},
+			expectedError: `Invalid component ID regexp "ref(1"`,
+		},
+		{
+			name:          "missing EAD list file",
+			filters:       filters{EADListFile: "/nonexistent/eads.txt"},
+			expectedError: `EAD list file "/nonexistent/eads.txt" could not be read`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := setFilters(testCase.filters)
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("expected error containing %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestReadEADListFile(t *testing.T) {
+	testCases := []struct {
+		name          string
+		contents      string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     "comments and blank lines",
+			contents: "# Regressions\nfales/mss_001\n\n  tamwag/aia_001  \n#fales/mss_002\n",
+			expected: []string{"fales/mss_001", "tamwag/aia_001"},
+		},
+		{
+			name:          "no repository code",
+			contents:      "fales/mss_001\nmss_002\n",
+			expectedError: `"mss_002" is not of the form [repository code]/[EAD ID]`,
+		},
+		{
+			name:          "path",
+			contents:      "findingaids_eads_v2/fales/mss_001\n",
+			expectedError: `"findingaids_eads_v2/fales/mss_001" is not of the form`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eadListFile := filepath.Join(t.TempDir(), "eads.txt")
+			err := os.WriteFile(eadListFile, []byte(testCase.contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			eadList, err := readEADListFile(eadListFile)
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error containing %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readEADListFile() failed: %s", err)
+			}
+			listed := []string{}
+			for testEAD := range eadList {
+				listed = append(listed, testEAD)
+			}
+			slices.Sort(listed)
+			if !slices.Equal(listed, testCase.expected) {
+				t.Errorf("expected %q, got %q", testCase.expected, listed)
+			}
+		})
+	}
+}
+
+// The EAD list and the other filters and the shard all apply.  An EAD list
+// which names EADs that aren't in the EAD root is an error.
+func TestSelectTestEADs(t *testing.T) {
+	eadListFile := filepath.Join(t.TempDir(), "eads.txt")
+	err := os.WriteFile(eadListFile, []byte("fales/mss_001\nfales/mss_002\ntamwag/mss_001\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setFilters(filters{EADListFile: eadListFile, ExcludeEADs: []string{"*_002"}})
+	if err != nil {
+		t.Fatalf("setFilters() failed: %s", err)
+	}
+	t.Cleanup(func() {
+		setFilters(filters{})
+		shard = shardSpec{}
+	})
+
+	selected, err := selectTestEADs(testFilterEADs)
+	if err != nil {
+		t.Fatalf("selectTestEADs() failed: %s", err)
+	}
+	expected := []string{"fales/mss_001", "tamwag/mss_001"}
+	if !slices.Equal(selected, expected) {
+		t.Errorf("expected %q, got %q", expected, selected)
+	}
+
+	shardSelections := []string{}
+	for _, shardValue := range []string{"1/2", "2/2"} {
+		shard.Set(shardValue)
+		shardSelection, err := selectTestEADs(testFilterEADs)
+		if err != nil {
+			t.Fatalf("selectTestEADs() with shard %s failed: %s", shardValue, err)
+		}
+		shardSelections = append(shardSelections, shardSelection...)
+	}
+	slices.Sort(shardSelections)
+	if !slices.Equal(shardSelections, expected) {
+		t.Errorf("expected the shards to select %q between them, got %q", expected, shardSelections)
+	}
+	shard = shardSpec{}
+
+	_, err = selectTestEADs([]string{"fales/mss_001", "tamwag/mss_001"})
+	if err == nil || !strings.HasSuffix(err.Error(), "names EADs which are not in the EAD root:\nfales/mss_002") {
+		t.Errorf("expected an error naming the missing EAD, got %v", err)
+	}
+}
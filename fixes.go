@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Per-file golden fixes, for v1 indexer bugs which the general massage rules
+// can't handle, and which only affect a few golden files.  Each fix is a file
+// golden-fixes/[file ID].json in this package's directory.
+const goldenFixesDirName = "golden-fixes"
+
+// See `massageRulesSourceFile`.
+const goldenFixesSourceFile = "fixes.go"
+
+type goldenFix struct {
+	Description  string                 `json:"description"`
+	Jira         string                 `json:"jira"`
+	Replacements []goldenFixReplacement `json:"replacements"`
+}
+
+// Replacements are applied in order, to the raw golden value if the
+// "file-id-specific" rule is the first massage rule, as it is in the shipped
+// rules file.
+type goldenFixReplacement struct {
+	Replace string `json:"replace"`
+	Search  string `json:"search"`
+}
+
+// Keyed by file ID.  Set by `setMassageRules`.
+var goldenFixes = map[string]goldenFix{}
+
+func goldenFixesDir() string {
+	return filepath.Join(rootPath, goldenFixesDirName)
+}
+
+// Fails if any of the search strings is not in the golden value, which means
+// that either the upstream golden file has changed, or the fix is obsolete.
+// Either way, we want to know rather than have the fix silently do nothing.
+func applyGoldenFix(golden string, fileID string, fix goldenFix) (string, int, error) {
+	fixedGolden := golden
+	replacements := 0
+	for i, replacement := range fix.Replacements {
+		if !strings.Contains(fixedGolden, replacement.Search) {
+			return "", replacements, fmt.Errorf("golden fix %s replacement %d (%s): search string not found: the golden file has changed, or the fix is obsolete",
+				filepath.Join(goldenFixesDirName, fileID+".json"), i+1, fix.Jira)
+		}
+		replacements += strings.Count(fixedGolden, replacement.Search)
+		fixedGolden = strings.ReplaceAll(fixedGolden, replacement.Search, replacement.Replace)
+	}
+
+	return fixedGolden, replacements, nil
+}
+
+// The golden fix files for the selected EADs and components which no tested
+// golden file used, e.g. because the component was renumbered upstream.  Like
+// a fix whose search string is no longer in the golden value, these are
+// obsolete, and would otherwise be silently ignored.  A fix is for the EAD
+// with the longest EAD ID which its file ID starts with, out of all the EADs
+// in the EAD root, so that fixes for EADs which weren't selected, or are in
+// other shards, aren't reported.
+func getStaleGoldenFixes(results []eadResult, testEADs []string, allTestEADs []string) []string {
+	usedFixes := map[string]bool{}
+	for _, result := range results {
+		for _, fileID := range result.GoldenFixes {
+			usedFixes[fileID] = true
+		}
+	}
+
+	staleFixes := []string{}
+	for _, fileID := range slices.Sorted(maps.Keys(goldenFixes)) {
+		fixTestEAD, fixEADID := "", ""
+		for _, testEAD := range allTestEADs {
+			eadID := parseEADID(testEAD)
+			if strings.HasPrefix(fileID, eadID) && len(eadID) > len(fixEADID) {
+				fixTestEAD, fixEADID = testEAD, eadID
+			}
+		}
+		if _, selected := slices.BinarySearch(testEADs, fixTestEAD); !selected {
+			continue
+		}
+		if fileID != fixEADID && !includesComponent(fileID) {
+			continue
+		}
+		if !usedFixes[fileID] {
+			staleFixes = append(staleFixes, filepath.Join(goldenFixesDirName, fileID+".json"))
+		}
+	}
+
+	return staleFixes
+}
+
+// The file IDs in `fileIDs` which have a golden fix.
+func getUsedGoldenFixes(fileIDs []string) []string {
+	return slices.DeleteFunc(slices.Clone(fileIDs), func(fileID string) bool {
+		_, ok := goldenFixes[fileID]
+		return !ok
+	})
+}
+
+func readGoldenFixes(fixesDir string) (map[string]goldenFix, error) {
+	fixes := map[string]goldenFix{}
+
+	dirEntries, err := os.ReadDir(fixesDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fixes, nil
+		}
+		return fixes, err
+	}
+
+	for _, dirEntry := range dirEntries {
+		fileID, isFixFile := strings.CutSuffix(dirEntry.Name(), ".json")
+		if dirEntry.IsDir() || !isFixFile {
+			continue
+		}
+
+		fix, err := readGoldenFixFile(filepath.Join(fixesDir, dirEntry.Name()))
+		if err != nil {
+			return fixes, fmt.Errorf(`golden fix file "%s": %s`, dirEntry.Name(), err)
+		}
+		fixes[fileID] = fix
+	}
+
+	return fixes, nil
+}
+
+func readGoldenFixFile(fixFile string) (goldenFix, error) {
+	fix := goldenFix{}
+
+	file, err := os.Open(fixFile)
+	if err != nil {
+		return fix, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&fix)
+	if err != nil {
+		return fix, err
+	}
+
+	if fix.Description == "" || fix.Jira == "" {
+		return fix, errors.New("a fix needs a description and a Jira link")
+	}
+	if len(fix.Replacements) == 0 {
+		return fix, errors.New("no replacements")
+	}
+	for i, replacement := range fix.Replacements {
+		if replacement.Search == "" {
+			return fix, fmt.Errorf("replacement %d has no search string", i+1)
+		}
+	}
+
+	return fix, nil
+}
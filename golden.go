@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The golden files are captures of the HTTP/1.1 requests which the v1 indexer
+// sent to Solr, e.g.:
+//
+//	POST /solr/findingaids/update?wt=ruby HTTP/1.1
+//	Content-Type: text/xml; charset=utf-8
+//	Content-Length: 1853
+//	...
+//
+//	<?xml version="1.0" encoding="UTF-8"?><add><doc>...</doc></add>
+type goldenRequest struct {
+	body string
+	// Name of the root element of the body: "add", "commit", or "delete".
+	bodyRoot string
+	header   http.Header
+	path     string
+}
+
+// A golden file which is not a well-formed capture of the expected kind of
+// Solr update request -- e.g. a truncated body, or a delete where an add was
+// expected.  This is a problem with the golden file rather than with the
+// go-ead-indexer output, so it's reported separately from mismatches.
+type goldenFileError struct {
+	err error
+}
+
+func (e goldenFileError) Error() string {
+	return e.err.Error()
+}
+
+func (e goldenFileError) Unwrap() error {
+	return e.err
+}
+
+func newGoldenFileError(format string, a ...any) error {
+	return goldenFileError{err: fmt.Errorf(format, a...)}
+}
+
+var solrUpdatePathRegExp = regexp.MustCompile(`^/solr/.+/update$`)
+
+func getXMLRootElementName(xmlString string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(xmlString))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if startElement, ok := token.(xml.StartElement); ok {
+			return startElement.Name.Local, nil
+		}
+	}
+}
+
+// Returns a `goldenFileError` if the capture is not a well-formed POST of UTF-8
+// XML to a Solr update handler, with a Content-Length which matches the body.
+func parseGoldenRequest(capture []byte) (goldenRequest, error) {
+	reader := bufio.NewReader(bytes.NewReader(capture))
+	request, err := http.ReadRequest(reader)
+	if err != nil {
+		return goldenRequest{}, newGoldenFileError("not a valid HTTP/1.1 request: %s", err)
+	}
+	defer request.Body.Close()
+
+	if request.Method != http.MethodPost {
+		return goldenRequest{}, newGoldenFileError(`expected a POST request, got "%s"`, request.Method)
+	}
+	if !solrUpdatePathRegExp.MatchString(request.URL.Path) {
+		return goldenRequest{}, newGoldenFileError(`expected a /solr/[core]/update path, got "%s"`,
+			request.URL.Path)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return goldenRequest{}, newGoldenFileError("invalid Content-Type: %s", err)
+	}
+	if mediaType != "text/xml" && mediaType != "application/xml" {
+		return goldenRequest{}, newGoldenFileError(`expected an XML Content-Type, got "%s"`, mediaType)
+	}
+	if !strings.EqualFold(params["charset"], "utf-8") {
+		return goldenRequest{}, newGoldenFileError(`expected charset "utf-8", got "%s"`, params["charset"])
+	}
+
+	// Without a Content-Length header, `http.ReadRequest` assumes an empty body,
+	// so a missing header would hide a truncated capture.
+	if request.Header.Get("Content-Length") == "" || len(request.TransferEncoding) > 0 {
+		return goldenRequest{}, newGoldenFileError("no Content-Length header")
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return goldenRequest{}, newGoldenFileError("body is shorter than Content-Length %d: %s",
+			request.ContentLength, err)
+	}
+	if trailingBytes, _ := io.Copy(io.Discard, reader); trailingBytes > 0 {
+		return goldenRequest{}, newGoldenFileError("body is %d bytes longer than Content-Length %d",
+			trailingBytes, request.ContentLength)
+	}
+
+	bodyRoot, err := getXMLRootElementName(string(body))
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("no root element")
+		}
+		return goldenRequest{}, newGoldenFileError("body is not valid XML: %s", err)
+	}
+
+	return goldenRequest{
+		body:     string(body),
+		bodyRoot: bodyRoot,
+		header:   request.Header,
+		path:     request.URL.Path,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testGoldenBody = `<?xml version="1.0" encoding="UTF-8"?><add><doc><field name="id">mos_2024</field></doc></add>`
+
+func makeTestGoldenCapture(requestLine string, contentType string, contentLength int, body string) string {
+	return fmt.Sprintf("%s\r\nContent-Type: %s\r\nAccept: */*\r\nUser-Agent: Ruby\r\nContent-Length: %d\r\nHost: localhost:8983\r\n\r\n%s",
+		requestLine, contentType, contentLength, body)
+}
+
+func TestParseGoldenRequest(t *testing.T) {
+	const validRequestLine = "POST /solr/findingaids/update?wt=ruby HTTP/1.1"
+	const validContentType = "text/xml; charset=utf-8"
+
+	capture := makeTestGoldenCapture(validRequestLine, validContentType, len(testGoldenBody), testGoldenBody)
+	request, err := parseGoldenRequest([]byte(capture))
+	if err != nil {
+		t.Fatalf("parseGoldenRequest() of valid capture failed: %s", err)
+	}
+	if request.body != testGoldenBody {
+		t.Errorf("body: expected %q, got %q", testGoldenBody, request.body)
+	}
+	if request.bodyRoot != "add" {
+		t.Errorf(`bodyRoot: expected "add", got %q`, request.bodyRoot)
+	}
+	if request.path != "/solr/findingaids/update" {
+		t.Errorf(`path: expected "/solr/findingaids/update", got %q`, request.path)
+	}
+}
+
+func TestParseGoldenRequestErrors(t *testing.T) {
+	const validRequestLine = "POST /solr/findingaids/update?wt=ruby HTTP/1.1"
+	const validContentType = "text/xml; charset=utf-8"
+
+	testCases := []struct {
+		name          string
+		capture       string
+		expectedError string
+	}{
+		{
+			name:          "GET",
+			capture:       makeTestGoldenCapture("GET /solr/findingaids/update HTTP/1.1", validContentType, len(testGoldenBody), testGoldenBody),
+			expectedError: "expected a POST request",
+		},
+		{
+			name:          "not an update path",
+			capture:       makeTestGoldenCapture("POST /solr/findingaids/select HTTP/1.1", validContentType, len(testGoldenBody), testGoldenBody),
+			expectedError: "expected a /solr/[core]/update path",
+		},
+		{
+			name:          "wrong charset",
+			capture:       makeTestGoldenCapture(validRequestLine, "text/xml; charset=iso-8859-1", len(testGoldenBody), testGoldenBody),
+			expectedError: `expected charset "utf-8"`,
+		},
+		{
+			name:          "not XML",
+			capture:       makeTestGoldenCapture(validRequestLine, "application/json; charset=utf-8", len(testGoldenBody), testGoldenBody),
+			expectedError: "expected an XML Content-Type",
+		},
+		{
+			name:          "truncated body",
+			capture:       makeTestGoldenCapture(validRequestLine, validContentType, len(testGoldenBody)+10, testGoldenBody),
+			expectedError: "body is shorter than Content-Length",
+		},
+		{
+			name:          "trailing bytes",
+			capture:       makeTestGoldenCapture(validRequestLine, validContentType, len(testGoldenBody)-1, testGoldenBody),
+			expectedError: "body is 1 bytes longer than Content-Length",
+		},
+		{
+			name:          "no headers",
+			capture:       testGoldenBody,
+			expectedError: "not a valid HTTP/1.1 request",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseGoldenRequest([]byte(testCase.capture))
+			if err == nil {
+				t.Fatalf("expected error containing %q, got nil", testCase.expectedError)
+			}
+			if !errors.As(err, &goldenFileError{}) {
+				t.Errorf("expected a goldenFileError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("expected error containing %q, got %q", testCase.expectedError, err)
+			}
+		})
+	}
+}
@@ -2,18 +2,18 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/nyulibraries/go-ead-indexer/pkg/ead"
 	"github.com/nyulibraries/go-ead-indexer/pkg/ead/collectiondoc"
 	"github.com/nyulibraries/go-ead-indexer/pkg/ead/component"
-	"github.com/nyulibraries/go-ead-indexer/pkg/ead/eadutil"
-	"github.com/nyulibraries/go-ead-indexer/pkg/util"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"runtime/debug"
 	"slices"
 	"strings"
 	"time"
@@ -23,29 +23,19 @@ const actualFileSuffix = "-add.xml"
 const diffFileSuffix = "-add.txt"
 const goldenFileSuffix = "-add.txt"
 
+var crashesDirPath string
 var diffsDirPath string
 var eadDirPath string
 var goldenFilesDirPath string
+var incremental bool
+var massageDiffs bool
+var numWorkers int
+var outputDirPath string
+var resume bool
 var rootPath string
+var shard shardSpec
 var tmpFilesDirPath string
 
-var httpHeadersRegExp = regexp.MustCompile("(?ms)^POST.*\r\n\r\n")
-
-// For https://jira.nyu.edu/browse/DLFA-243
-// Can't use this:
-// &lt;em&gt;(?!.*&lt;em&gt;)(.*?)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;
-// ...because Go does not support negative lookahead.  We instead allow this
-// regexp to capture the largest match which would include the nested sub-match
-// we need to actually work with, and let a separate non-regexp-based process
-// take care of the rest.
-var emUnittitleMassage = regexp.MustCompile(`&lt;em&gt;(.*?)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;`)
-
-// Go \s metachar is [\t\n\f\r ], and does not include NBSP.
-// Source: https://pkg.go.dev/regexp/syntax
-var multipleConsecutiveWhitespace = regexp.MustCompile(`[\s ]{2}\s*`)
-var leadingWhitespaceInFieldContent = regexp.MustCompile(`>[\s ]+`)
-var trailingWhitespaceInFieldContent = regexp.MustCompile(`[\s ]+</field>`)
-
 // We need to get the absolute path to this package in order to get the absolute
 // path to the tmp/ directory.  We don't want the wrong directories clobbered by
 // the output if this script is run from somewhere outside of this directory.
@@ -60,16 +50,21 @@ func init() {
 	rootPath = filepath.Dir(filename)
 }
 
-func abortBadUsage(err error) {
+func abortBadUsage(flagSet *flag.FlagSet, err error) {
 	if err != nil {
 		log.Println(err.Error())
 	}
-	usage()
-	os.Exit(1)
+	flagSet.Usage()
+	os.Exit(exitUsage)
 }
 
 func clean() error {
-	err := os.RemoveAll(diffsDirPath)
+	err := os.RemoveAll(crashesDirPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(diffsDirPath)
 	if err != nil {
 		return err
 	}
@@ -95,6 +90,32 @@ func clean() error {
 	return nil
 }
 
+// All test EADs in the EAD root, regardless of filters and shard.
+func getAllTestEADs() []string {
+	testEADs := []string{}
+
+	err := filepath.WalkDir(eadDirPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if !dirEntry.IsDir() && filepath.Ext(path) == ".xml" {
+			repositoryCode := filepath.Base(filepath.Dir(path))
+			eadID := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			testEADs = append(testEADs, fmt.Sprintf("%s/%s", repositoryCode, eadID))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(fmt.Sprintf(`getAllTestEADs() failed: %s`, err))
+
+	}
+
+	// `filepath.WalkDir` walks in lexical order of the file paths, which is not
+	// necessarily the same as lexical order of the test EAD strings.  Everything
+	// downstream assumes the latter: diff files, tmp actual files, and log lines
+	// are all emitted in this order, regardless of the number of workers.
+	slices.Sort(testEADs)
+
+	return testEADs
+}
+
 func getEADValue(testEAD string) (string, error) {
 	return getTestdataFileContents(getEADFilePath(testEAD))
 }
@@ -102,158 +123,126 @@ func getEADValue(testEAD string) (string, error) {
 func getEADFilePath(testEAD string) string {
 	return filepath.Join(eadDirPath, testEAD+".xml")
 }
-func getGoldenFileIDs(eadID string) []string {
-	goldenFileIDs := []string{}
-
-	err := filepath.WalkDir(filepath.Join(goldenFilesDirPath, eadID),
-		func(path string, dirEntry fs.DirEntry, err error) error {
-			if !dirEntry.IsDir() &&
-				filepath.Ext(path) == goldenFileSuffix &&
-				!strings.HasSuffix(path, "-commit-add") {
 
-				goldenFileIDs = append(goldenFileIDs, strings.TrimSuffix(filepath.Base(path),
-					goldenFileSuffix))
-			}
-			return nil
-		})
+// Panicking version of `readGoldenFileIDs`, for use in the tests, where the
+// panic is recovered and reported by `testSingleEAD`.
+func getGoldenFileIDs(eadID string) []string {
+	goldenFileIDs, err := readGoldenFileIDs(eadID)
 	if err != nil {
-		log.Panic(fmt.Sprintf(`getGoldenFileIDs("%s") failed: %s`, eadID, err))
+		// Not `log.Panic`, which would also write directly to the stderr log,
+		// out of order with the buffered output of parallel workers.
+		panic(fmt.Sprintf(`getGoldenFileIDs("%s") failed: %s`, eadID, err))
 	}
 
-	// The slice might already be sorted, but just in case, sort it.
-	// Sorting helps with gauging progress by tailing the logs, and helps with
-	// debugging in case log messages don't clearly indicate where an error
-	// occurred -- in such cases the last successfully tested EAD file lets us
-	// know where to start looking.
-	slices.Sort(goldenFileIDs)
-
 	return goldenFileIDs
 }
 
+// Returns the overlay file for the golden file if there is one.
 func getGoldenFilePath(testEAD string, fileID string) string {
+	overlayFilePath := getOverlayFilePath(testEAD, fileID)
+	if _, err := os.Stat(overlayFilePath); err == nil {
+		return overlayFilePath
+	}
+
 	return filepath.Join(goldenFilesDirPath, testEAD, fileID+goldenFileSuffix)
 }
 
+// Returns the body of the add request captured in the golden file.  A golden
+// file which can't be parsed, or which captured some other kind of request,
+// results in a `goldenFileError`, as does an overlay file without valid
+// metadata.
 func getGoldenFileValue(eadID string, fileID string) (string, error) {
-	fileContents, err := getTestdataFileContents(getGoldenFilePath(eadID, fileID))
+	goldenFilePath := getGoldenFilePath(eadID, fileID)
+	fileContents, err := os.ReadFile(goldenFilePath)
 	if err != nil {
 		return "", err
 	}
 
-	xmlBody := httpHeadersRegExp.ReplaceAllString(fileContents, "")
-
-	return xmlBody, nil
-}
-
-func getTestdataFileContents(filename string) (string, error) {
-	bytes, err := os.ReadFile(filename)
-
+	request, err := parseGoldenRequest(fileContents)
 	if err != nil {
-		return filename, err
+		return "", newGoldenFileError("Golden file error in %s: %s", goldenFilePath, err)
+	}
+	if request.bodyRoot != "add" {
+		return "", newGoldenFileError(`Golden file error in %s: expected an <add> request, got <%s>`,
+			goldenFilePath, request.bodyRoot)
+	}
+	if goldenFilePath == getOverlayFilePath(eadID, fileID) {
+		_, err = parseGoldenOverlay(eadID, fileID, request.header)
+		if err != nil {
+			return "", newGoldenFileError("Golden file error in overlay file %s: %s", goldenFilePath, err)
+		}
 	}
 
-	return string(bytes), nil
+	return request.body, nil
 }
 
-func getTestEADs() []string {
-	testEADs := []string{}
-
-	err := filepath.WalkDir(eadDirPath, func(path string, dirEntry fs.DirEntry, err error) error {
-		if !dirEntry.IsDir() && filepath.Ext(path) == ".xml" {
-			repositoryCode := filepath.Base(filepath.Dir(path))
-			eadID := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
-			testEADs = append(testEADs, fmt.Sprintf("%s/%s", repositoryCode, eadID))
-		}
-		return nil
-	})
+// https://jira.nyu.edu/browse/DLFA-243
+// Overlay files are not massaged: they already contain the correct value, which
+// for accepted values is go-ead-indexer's own output.
+func getMassagedGoldenValue(eadID string, fileID string) (string, massageTrace, error) {
+	goldenValue, err := getGoldenFileValue(eadID, fileID)
 	if err != nil {
-		log.Panic(fmt.Sprintf(`getTestEADs() failed: %s`, err))
-
+		return "", nil, err
+	}
+	if getGoldenFilePath(eadID, fileID) == getOverlayFilePath(eadID, fileID) {
+		return goldenValue, nil, nil
 	}
 
-	return testEADs
-}
-
-func isDirectory(path string) bool {
-	fileInfo, err := os.Stat(path)
+	massagedGoldenValue, trace, err := massageGolden(goldenValue, parseRepositoryCode(eadID), fileID)
 	if err != nil {
-		log.Panic(fmt.Sprintf(`isDirectory("%s") failed with error: %s`, path, err))
+		return "", nil, newGoldenFileError("Golden file error in %s: %s", getGoldenFilePath(eadID, fileID), err)
 	}
 
-	return fileInfo.IsDir()
+	return massagedGoldenValue, trace, nil
 }
 
-// https://jira.nyu.edu/browse/DLFA-243
-// Applied to all golden files without exception.
-func massageGoldenAll(golden string) string {
-	// DLFA-243: "Convert all "&nbsp;" strings in golden files to actual NBSP characters."
-	massagedGolden := strings.ReplaceAll(golden, "&amp;nbsp;", " ")
-
-	// DLFA-243: "Remove erroneously inserted EAD tags in Solr field content from golden files."
-	// This is the second part of the massage.  The first part is dealt with in
-	// `massageGoldenFileIDSpecific()`.
-	// Example of what's being fixed here:
-	// This:
-	//     <unittitle><title render="italic">Ayuda Medica Internacional</title>(photocopied clippings and notes) <title render="italic"></title></unittitle>
-	// ...is mangled by v1 indexer into:
-	//     <field name="unittitle_ssm">&lt;em&gt;Ayuda Medica Internacional&lt;/em&gt;(photocopied clippings and notes) &lt;em&gt;&amp;lt;/unittitle&amp;gt;&lt;/em&gt;</field>
-	//
-	// This first set of matches might include the nested sub-match we actually
-	// care about.  Go does not support negative lookahead so we settle for this
-	// wide net casting and then use non-regexp-based processing to take care of
-	// the rest.
-	matches := emUnittitleMassage.FindStringSubmatch(massagedGolden)
-	if len(matches) == 2 {
-		// Isolate the rightmost match.
-		lastOccurrenceIndex := strings.LastIndex(matches[0], "&lt;em&gt")
-		lastOccurrence := matches[0][lastOccurrenceIndex:]
-		// Set up the replacement based on the rightmost match.
-		matches = emUnittitleMassage.FindStringSubmatch(lastOccurrence)
-		cleanString := "&lt;em&gt;&lt;/em&gt;" + matches[1]
-		// Do the replacement everywhere.
-		massagedGolden = strings.ReplaceAll(massagedGolden, lastOccurrence, cleanString)
-	} else {
-		// Do nothing.
-	}
+func getTestdataFileContents(filename string) (string, error) {
+	bytes, err := os.ReadFile(filename)
 
-	// DLFA-243: "Convert all double-escaped ampersand strings in golden files to single-escaped."
-	massagedGolden = strings.ReplaceAll(massagedGolden, "&amp;amp;", "&amp;")
+	if err != nil {
+		return filename, err
+	}
 
-	// Whitespace massages
-	massagedGolden = strings.ReplaceAll(massagedGolden, "\n", " ")
-	massagedGolden = multipleConsecutiveWhitespace.ReplaceAllString(
-		massagedGolden, " ")
-	massagedGolden = strings.ReplaceAll(massagedGolden,
-		"&lt;/em&gt; &lt;em&gt;", "&lt;/em&gt;&lt;em&gt;")
-	massagedGolden = leadingWhitespaceInFieldContent.ReplaceAllString(
-		massagedGolden, ">")
-	massagedGolden = trailingWhitespaceInFieldContent.ReplaceAllString(
-		massagedGolden, `</field>`)
+	return string(bytes), nil
+}
 
-	return massagedGolden
+// The test EADs selected by the filters and the shard.
+func getTestEADs() ([]string, error) {
+	return selectTestEADs(getAllTestEADs())
 }
 
-// https://jira.nyu.edu/browse/DLFA-243
-func massageGoldenFileIDSpecific(golden string, fileID string) string {
-	var massagedGolden = golden
+func readGoldenFileIDs(eadID string) ([]string, error) {
+	goldenFileIDs := []string{}
 
-	// These changes couldn't be handled by the code which deals with the
-	// general case for this v1 indexer bug:
-	// https://jira.nyu.edu/browse/DLFA-211?focusedCommentId=11487878&page=com.atlassian.jira.plugin.system.issuetabpanels:comment-tabpanel#comment-11487878
-	// Since it's only a couple of files, we brute force them.
-	if fileID == "alba_218aspace_ref45" {
-		massagedGolden = strings.ReplaceAll(massagedGolden,
-			"&lt;em&gt;(some with &amp;lt;title render=\"italic\"/&amp;gt;annotations by Friedman)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;",
-			"&lt;em&gt;&lt;/em&gt;(some with &lt;em&gt;&lt;/em&gt;annotations by Friedman)",
-		)
-	} else if fileID == "alba_236aspace_ref26" {
-		massagedGolden = strings.ReplaceAll(massagedGolden,
-			"&lt;em&gt;George Seldes, &amp;lt;title render=\"italic\"&amp;gt;\"&lt;/em&gt;",
-			"&lt;em&gt;&lt;/em&gt;George Seldes, &lt;em&gt;\"&lt;/em&gt;",
-		)
+	err := filepath.WalkDir(filepath.Join(goldenFilesDirPath, eadID),
+		func(path string, dirEntry fs.DirEntry, err error) error {
+			// `dirEntry` is nil if the golden files directory doesn't exist.
+			if err != nil {
+				return err
+			}
+			// Note that `filepath.Ext()` can't be used for this check: it would
+			// return ".txt", never "-add.txt".
+			if !dirEntry.IsDir() &&
+				strings.HasSuffix(path, goldenFileSuffix) &&
+				!strings.HasSuffix(path, "-commit"+goldenFileSuffix) {
+
+				goldenFileIDs = append(goldenFileIDs, strings.TrimSuffix(filepath.Base(path),
+					goldenFileSuffix))
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
 	}
 
-	return massagedGolden
+	// The slice might already be sorted, but just in case, sort it.
+	// Sorting helps with gauging progress by tailing the logs, and helps with
+	// debugging in case log messages don't clearly indicate where an error
+	// occurred -- in such cases the last successfully tested EAD file lets us
+	// know where to start looking.
+	slices.Sort(goldenFileIDs)
+
+	return goldenFileIDs, nil
 }
 
 func parseEADID(testEAD string) string {
@@ -264,48 +253,83 @@ func parseRepositoryCode(testEAD string) string {
 	return filepath.Dir(testEAD)
 }
 
-func setDirectoryPaths() {
-	args := os.Args
+// Errored and timed out EADs are reported separately from the golden mismatches
+// and missing components in the stderr log, because they indicate problems with
+// the EADs, the indexer, or the test execution rather than with the indexer
+// output.
+func reportUntestedEADs(w io.Writer, results []eadResult) {
+	for _, status := range []string{statusErrored, statusTimeout} {
+		untestedResults := slices.DeleteFunc(slices.Clone(results), func(result eadResult) bool {
+			return result.Status != status
+		})
+		if len(untestedResults) == 0 {
+			continue
+		}
 
-	if len(args) < 3 {
-		abortBadUsage(fmt.Errorf("Wrong number of args"))
+		report := strings.Builder{}
+		fmt.Fprintf(&report, "%d EADs could not be tested (%s):\n", len(untestedResults), status)
+		for _, result := range untestedResults {
+			fmt.Fprintf(&report, "%s: %s\n", result.TestEAD, result.Error)
+			if result.CrashFile != "" {
+				fmt.Fprintf(&report, "    crash file: %s\n", result.CrashFile)
+			}
+		}
+		fmt.Fprint(w, report.String())
 	}
+}
 
+func setDirectoryPaths(flagSet *flag.FlagSet, eadDir string, goldenFilesDir string) {
 	// Declare `err` instead of doing `eadDirPath, err :=`, which shadows package
 	// level var `eadDirPath`.
 	var err error
-	eadDirPath, err = filepath.Abs(args[1])
-	// Very basic validation of directories:
-	// - No error when resolving to absolute path
-	// - Is a directory and not a symlink -- because `filepath.WalkDir` does not
-	//   work on symlinks.
-	// - Directory name matches repo name.  This is not strictly necessary, because
-	//   we should be able to rename the directory if we want, but this is just
-	//   a one-off test (for now -- maybe we'll make a permanent one later).
-	//   This also has the benefit of preventing possible accidental use of the
-	//   FABified repo, which has a different name.
-	if err != nil || !isDirectory(eadDirPath) || !strings.HasSuffix(eadDirPath, "findingaids_eads_v2") {
-		abortBadUsage(fmt.Errorf(`Path "%s" is not a valid findingaids_eads_v2 repo path`, args[1]))
+	// The directories are validated by their contents rather than their names,
+	// so renamed clones, tarball extracts, and temp directories can be used.
+	// Symlinks are resolved because `filepath.WalkDir` does not follow a
+	// symlinked root.
+	eadDirPath, err = resolveDirectoryPath(eadDir)
+	if err == nil {
+		err = validateEADRoot(eadDirPath)
 	}
+	if err != nil {
+		abortBadUsage(flagSet, fmt.Errorf(`Path "%s" is not a valid EAD root: %s`, eadDir, err))
+	}
+
+	goldenFilesDirPath, err = resolveDirectoryPath(goldenFilesDir)
+	if err == nil {
+		err = validateGoldenRoot(goldenFilesDirPath)
+	}
+	if err != nil {
+		abortBadUsage(flagSet, fmt.Errorf(`Path "%s" is not a valid golden files root: %s`, goldenFilesDir, err))
+	}
+}
 
-	goldenFilesDirPath, err = filepath.Abs(args[2])
-	if err != nil || !isDirectory(goldenFilesDirPath) || !strings.HasSuffix(goldenFilesDirPath, "http-requests") {
-		abortBadUsage(fmt.Errorf(`Path "%s" is not a valid dlfa-188_v1-indexer-http-requests repo http-requests/ subdirectory`, args[2]))
+// An empty `outputDir` means this package's directory, which is where the
+// outputs have always been written.
+func setOutputDirPaths(flagSet *flag.FlagSet, outputDir string) {
+	if outputDir == "" {
+		outputDirPath = rootPath
+	} else {
+		var err error
+		outputDirPath, err = filepath.Abs(outputDir)
+		if err != nil {
+			abortBadUsage(flagSet, fmt.Errorf(`Path "%s" is not a valid output directory path: %s`, outputDir, err))
+		}
 	}
 
-	diffsDirPath = filepath.Join(rootPath, "diffs")
-	tmpFilesDirPath = filepath.Join(rootPath, "tmp", "actual")
+	crashesDirPath = filepath.Join(outputDirPath, "crashes")
+	diffsDirPath = filepath.Join(outputDirPath, "diffs")
+	tmpFilesDirPath = filepath.Join(outputDirPath, "tmp", "actual")
 }
 
 func testCollectionDocSolrAddMessage(testEAD string,
-	solrAddMessage collectiondoc.SolrAddMessage) error {
+	solrAddMessage collectiondoc.SolrAddMessage) (massageTrace, []string, error) {
 	eadID := parseEADID(testEAD)
 
 	return testSolrAddMessageXML(testEAD, eadID, fmt.Sprintf("%s", solrAddMessage))
 }
 
 func testComponentSolrAddMessage(testEAD string, fileID string,
-	solrAddMessage component.SolrAddMessage) error {
+	solrAddMessage component.SolrAddMessage) (massageTrace, []string, error) {
 
 	return testSolrAddMessageXML(testEAD, fileID, fmt.Sprintf("%s", solrAddMessage))
 }
@@ -314,8 +338,10 @@ func testNoMissingComponents(testEAD string, componentIDs []string) error {
 	missingComponents := []string{}
 
 	goldenFileIDs := getGoldenFileIDs(testEAD)
+	// In a run with component filters, golden files for the filtered out
+	// components are not expected to have been tested.
 	goldenFileIDs = slices.DeleteFunc(goldenFileIDs, func(goldenFileID string) bool {
-		return goldenFileID == parseEADID(testEAD)
+		return goldenFileID == parseEADID(testEAD) || !includesComponent(goldenFileID)
 	})
 
 	for _, goldenFileID := range goldenFileIDs {
@@ -328,57 +354,296 @@ func testNoMissingComponents(testEAD string, componentIDs []string) error {
 		slices.SortStableFunc(missingComponents, func(a string, b string) int {
 			return strings.Compare(a, b)
 		})
-		failMessage := fmt.Sprintf("`EAD.Components` for testEAD %s is missing the following component IDs:\n%s",
-			testEAD, strings.Join(missingComponents, "\n"))
-		return fmt.Errorf(failMessage)
+		return missingComponentsError{componentIDs: missingComponents, testEAD: testEAD}
 	}
 
 	return nil
 }
 
+// Tests a single EAD.  All output is buffered in the returned `eadTestOutput`
+// rather than written directly to stdout and stderr, so that parallel workers
+// don't interleave their log lines.
+//
+// A panic or an execution error stops the testing of this EAD only: the EAD is
+// recorded as errored, a crash file is written, and the run moves on.
+func testSingleEAD(testEAD string) (output *eadTestOutput) {
+	output = newEADTestOutput(testEAD)
+	defer output.recoverPanic()
+
+	fmt.Fprintf(&output.stdout, "[ %s ] Testing %s\n", time.Now().Format("2006-01-02 15:04:05"), testEAD)
+	eadXML, err := getEADValue(testEAD)
+	if err != nil {
+		output.errored(fmt.Sprintf(`getEADValue("%s") failed: %s`, testEAD, err), debug.Stack())
+
+		return output
+	}
+
+	repositoryCode := parseRepositoryCode(testEAD)
+	eadToTest, err := ead.New(repositoryCode, eadXML)
+	if err != nil {
+		output.errored(fmt.Sprintf(`ead.New("%s", [EADXML for %s ]) failed: %s`, repositoryCode, testEAD, err), debug.Stack())
+
+		return output
+	}
+
+	// The file IDs whose golden files were tested against, so that the overlay
+	// files and golden fixes which were used can be recorded.
+	testedFileIDs := []string{parseEADID(testEAD)}
+	defer func() {
+		overlays, err := getUsedOverlays(testEAD, testedFileIDs)
+		if err != nil {
+			output.logger.Println(fmt.Sprintf(`getUsedOverlays("%s") failed: %s`, testEAD, err))
+		}
+		output.result.Overlays = overlays
+		output.result.GoldenFixes = getUsedGoldenFixes(testedFileIDs)
+	}()
+
+	trace, relaxations, err := testCollectionDocSolrAddMessage(testEAD, eadToTest.CollectionDoc.SolrAddMessage)
+	output.recordMassageTrace(parseEADID(testEAD), trace)
+	output.recordRelaxedMatch(parseEADID(testEAD), relaxations)
+	output.countSolrAddMessageResult(parseEADID(testEAD), err)
+	if err != nil {
+		if errors.As(err, &executionError{}) {
+			output.errored(err.Error(), debug.Stack())
+
+			return output
+		}
+		output.fail(err.Error())
+	}
+
+	// `index.IndexEADFile` would panic on the nil `EAD.Components`, so there's
+	// no request sequence to check either.
+	if eadToTest.Components == nil {
+		fmt.Fprintln(&output.stdout, testEAD+" has no components.  Skipping component and request sequence tests")
+
+		return output
+	}
+
+	componentIDs := []string{}
+	numFilteredOutComponents := 0
+	for _, component := range *eadToTest.Components {
+		componentIDs = append(componentIDs, component.ID)
+		if !includesComponent(component.ID) {
+			numFilteredOutComponents++
+			continue
+		}
+		output.result.Counts.ComponentsTested++
+		testedFileIDs = append(testedFileIDs, component.ID)
+		trace, relaxations, err = testComponentSolrAddMessage(testEAD, component.ID,
+			component.SolrAddMessage)
+		output.recordMassageTrace(component.ID, trace)
+		output.recordRelaxedMatch(component.ID, relaxations)
+		output.countSolrAddMessageResult(component.ID, err)
+		if err != nil {
+			if errors.As(err, &executionError{}) {
+				output.errored(err.Error(), debug.Stack())
+
+				return output
+			}
+			output.fail(err.Error())
+		}
+	}
+
+	if numFilteredOutComponents > 0 {
+		fmt.Fprintf(&output.stdout, "%s: skipped %d components excluded by the component filters\n",
+			testEAD, numFilteredOutComponents)
+	}
+
+	err = testNoMissingComponents(testEAD, componentIDs)
+	if err != nil {
+		missingComponents := missingComponentsError{}
+		if errors.As(err, &missingComponents) {
+			output.result.Counts.MissingComponents = len(missingComponents.componentIDs)
+		}
+		output.fail(err.Error())
+	}
+
+	err = testRequestSequence(testEAD, eadToTest)
+	if err != nil {
+		if errors.As(err, &executionError{}) {
+			output.errored(err.Error(), debug.Stack())
+
+			return output
+		}
+		if errors.As(err, &goldenFileError{}) {
+			output.result.Counts.GoldenFileErrors++
+		} else {
+			output.result.Counts.SequenceMismatches++
+		}
+		output.fail(err.Error())
+	}
+
+	return output
+}
+
+// Whether a result from the cache or the checkpoint journal can stand in for
+// testing the EAD again.  A timeout might have been caused by load on the
+// machine rather than by the inputs, so it's worth trying again.
+func isReusableResult(result eadResult, inputs inputHashes) bool {
+	return result.Inputs == inputs && result.Status != "" && result.Status != statusTimeout
+}
+
+// When resuming, an EAD which was recorded in the checkpoint journal by the
+// interrupted run is not tested again, and its outputs are kept, as long as its
+// input hashes match those of the journal record and it didn't time out.
+// Likewise in incremental mode for an EAD's cached result.  Otherwise, any
+// previous outputs are removed, the EAD is tested, and the result is recorded
+// in the checkpoint journal.
+func testEADIfNeeded(testEAD string) *eadTestOutput {
+	inputs, inputHashesErr := getInputHashes(testEAD)
+	if inputHashesErr != nil {
+		// Go ahead and test anyway.  The empty `inputs` will never match a
+		// cached result, so the EAD will be tested again in the next run.
+	} else if completedResult, ok := completedResults[testEAD]; ok && isReusableResult(completedResult, inputs) {
+		output := newEADTestOutput(testEAD)
+		output.result = completedResult
+		fmt.Fprintf(&output.stdout, "[ %s ] Skipping %s: completed by interrupted run (%s)\n",
+			time.Now().Format("2006-01-02 15:04:05"), testEAD, completedResult.Status)
+
+		return output
+	} else if cachedResult, ok := cachedResults[testEAD]; ok && isReusableResult(cachedResult, inputs) {
+		output := newEADTestOutput(testEAD)
+		output.result = cachedResult
+		fmt.Fprintf(&output.stdout, "[ %s ] Skipping %s: inputs unchanged since last run (%s)\n",
+			time.Now().Format("2006-01-02 15:04:05"), testEAD, cachedResult.Status)
+
+		return output
+	}
+
+	err := removeEADOutputs(testEAD)
+	if err != nil {
+		log.Panic(fmt.Sprintf(`removeEADOutputs("%s") failed: %s`, testEAD, err))
+	}
+
+	startTime := time.Now()
+	output := testSingleEADWithTimeout(testEAD)
+	output.result.ElapsedSeconds = time.Since(startTime).Seconds()
+	if inputHashesErr != nil {
+		output.logger.Println(fmt.Sprintf(`getInputHashes("%s") failed: %s`, testEAD, inputHashesErr))
+	}
+	output.result.Inputs = inputs
+	output.result.Stderr = output.stderr.String()
+	output.result.Stdout = output.stdout.String()
+
+	err = checkpointJournal.record(output.result)
+	if err != nil {
+		log.Panic(fmt.Sprintf(`Recording "%s" in checkpoint journal failed: %s`, testEAD, err))
+	}
+
+	return output
+}
+
+// Fans the test EADs out to `workers` goroutines.  Each EAD writes only to its
+// own diff and tmp files, so the files on disk do not depend on scheduling.
+// The buffered output of each EAD is flushed in `testEADs` order: we wait on
+// the output for EAD i before flushing anything for EAD i+1, even if later
+// EADs finished first.
+func testAllEADs(testEADs []string, workers int) []eadResult {
+	outputs := make([]chan *eadTestOutput, len(testEADs))
+	for i := range outputs {
+		outputs[i] = make(chan *eadTestOutput, 1)
+	}
+
+	jobs := make(chan int)
+	go func() {
+		for i := range testEADs {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer exitOnPanic()
+			for i := range jobs {
+				outputs[i] <- testEADIfNeeded(testEADs[i])
+			}
+		}()
+	}
+
+	results := []eadResult{}
+	for i := range testEADs {
+		output := <-outputs[i]
+		output.flush()
+		results = append(results, output.result)
+	}
+
+	return results
+}
+
+// Also returns the massage trace of the golden value, if it could be read, and
+// the relaxations needed for a match: see `compareSolrAddMessageXML`.
 func testSolrAddMessageXML(testEAD string, fileID string,
-	actualValue string) error {
+	actualValue string) (massageTrace, []string, error) {
 
-	goldenValue, err := getGoldenFileValue(testEAD, fileID)
+	massagedGoldenValue, trace, err := getMassagedGoldenValue(testEAD, fileID)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
+		if errors.As(err, &goldenFileError{}) {
+			// Also a test fail, but it's the golden file that needs fixing.
+			return nil, nil, err
+		} else if errors.Is(err, os.ErrNotExist) {
 			// This is a test fail, not a fatal test execution error.
 			// A missing golden file means that a Solr add message was created
 			// for a component that shouldn't exist.
-			return fmt.Errorf("No golden file exists for \"%s\": %s",
+			return nil, nil, newMissingGoldenError("No golden file exists for \"%s\": %s",
 				fileID, err)
 		} else {
-			return fmt.Errorf("Error retrieving golden value for \"%s\": %s",
+			return nil, nil, newExecutionError("Error retrieving golden value for \"%s\": %s",
 				fileID, err)
 		}
 	}
 
-	// https://jira.nyu.edu/browse/DLFA-243
-	massageGoldenValueStep1 := massageGoldenFileIDSpecific(goldenValue, fileID)
-	massagedGoldenValue := massageGoldenAll(massageGoldenValueStep1)
+	match, relaxations, err := compareSolrAddMessageXML(massagedGoldenValue, actualValue)
+	if err != nil {
+		if errors.As(err, &goldenFileError{}) {
+			return trace, nil, err
+		}
+		return trace, nil, newExecutionError("Error comparing golden and actual values for test case \"%s/%s\": %s",
+			testEAD, fileID, err)
+	}
 
-	if actualValue != massagedGoldenValue {
+	if !match {
 		err := writeActualSolrXMLToTmp(testEAD, fileID, actualValue)
 		if err != nil {
-			return fmt.Errorf("Error writing actual temp file for test case \"%s/%s\": %s",
+			return trace, nil, newExecutionError("Error writing actual temp file for test case \"%s/%s\": %s",
 				testEAD, fileID, err)
 		}
 
-		prettifiedMassagedGolden := eadutil.PrettifySolrAddMessageXML(massagedGoldenValue)
-		prettifiedActual := eadutil.PrettifySolrAddMessageXML(actualValue)
-
-		diff := util.DiffStrings("golden [PRETTIFIED]", prettifiedMassagedGolden,
-			"actual [PRETTIFIED]", prettifiedActual)
+		diff, stats := diffPrettifiedWithStats("golden", massagedGoldenValue, "actual", actualValue)
 		err = writeDiffFile(testEAD, fileID, diff)
 		if err != nil {
-			return fmt.Errorf("Error writing diff file for test case \"%s/%s\": %s",
+			return trace, nil, newExecutionError("Error writing diff file for test case \"%s/%s\": %s",
 				testEAD, fileID, err)
 		}
 
-		return fmt.Errorf("%s golden and actual values do not match\n", fileID)
+		// In "exact" comparison, the values haven't been parsed yet.  If one of
+		// them can't be, there's no field diff, but it's still a mismatch, and
+		// the diff file has already been written.
+		mismatchNote := ""
+		fieldDiffReport, err := getFieldDiffReport(testEAD, fileID, massagedGoldenValue, actualValue)
+		if err != nil {
+			mismatchNote = fmt.Sprintf(" (no field diff: %s)", err)
+		} else {
+			err = writeFieldDiffFiles(fieldDiffReport)
+			if err != nil {
+				return trace, nil, newExecutionError("Error writing field diff files for test case \"%s/%s\": %s",
+					testEAD, fileID, err)
+			}
+		}
+
+		if massageDiffs && getGoldenFilePath(testEAD, fileID) != getOverlayFilePath(testEAD, fileID) {
+			err = writeMassageDiffForTestCase(testEAD, fileID)
+			if err != nil {
+				return trace, nil, newExecutionError("Error writing massage diff file for test case \"%s/%s\": %s",
+					testEAD, fileID, err)
+			}
+		}
+
+		return trace, nil, newMismatchError(stats, "%s golden and actual values do not match (%s)%s\n", fileID,
+			stats, mismatchNote)
 	}
 
-	return nil
+	return trace, relaxations, nil
 }
 
 func diffFile(testEAD string, fileID string) string {
@@ -390,76 +655,74 @@ func tmpFile(testEAD string, fileID string) string {
 }
 
 func usage() {
-	log.Println("usage: go run main.go [path to findingaids_eads_v2] [path to dlfa-188_v1-indexer-http-requests-xml/http-requests/]")
+	fmt.Fprintln(os.Stderr, "usage: go run . <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", command.name, command.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "go run . <command> -h" for help with a command.`)
 }
 
 func writeActualSolrXMLToTmp(testEAD string, fileID string, actual string) error {
-	tmpFile := tmpFile(testEAD, fileID)
-	err := os.MkdirAll(filepath.Dir(tmpFile), 0755)
-	if err != nil {
-		return err
-	}
+	return guardedWrite(testEAD, func() error {
+		tmpFile := tmpFile(testEAD, fileID)
+		err := os.MkdirAll(filepath.Dir(tmpFile), 0755)
+		if err != nil {
+			return err
+		}
 
-	return os.WriteFile(tmpFile, []byte(actual), 0644)
+		return os.WriteFile(tmpFile, []byte(actual), 0644)
+	})
 }
 
-func writeDiffFile(testEAD string, fileID string, diff string) error {
-	diffFile := diffFile(testEAD, fileID)
-	err := os.MkdirAll(filepath.Dir(diffFile), 0755)
+func writeMassageDiffForTestCase(testEAD string, fileID string) error {
+	goldenValue, err := getGoldenFileValue(testEAD, fileID)
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(diffFile, []byte(diff), 0644)
-}
-
-func main() {
-	setDirectoryPaths()
-
-	err := clean()
+	massageDiff, err := getMassageDiff(testEAD, fileID, goldenValue)
 	if err != nil {
-		log.Panic("clean() error: " + err.Error())
+		return err
 	}
 
-	testEADs := getTestEADs()
-
-	for _, testEAD := range testEADs {
-		fmt.Printf("[ %s ] Testing %s\n", time.Now().Format("2006-01-02 15:04:05"), testEAD)
-		eadXML, err := getEADValue(testEAD)
-		if err != nil {
-			log.Println(fmt.Sprintf(`getEADValue("%s") failed: %s`, testEAD, err))
-		}
+	return writeMassageDiffFile(testEAD, fileID, massageDiff)
+}
 
-		repositoryCode := parseRepositoryCode(testEAD)
-		eadToTest, err := ead.New(repositoryCode, eadXML)
+func writeDiffFile(testEAD string, fileID string, diff string) error {
+	return guardedWrite(testEAD, func() error {
+		diffFile := diffFile(testEAD, fileID)
+		err := os.MkdirAll(filepath.Dir(diffFile), 0755)
 		if err != nil {
-			log.Println(fmt.Sprintf(`ead.New("%s", [EADXML for %s ]) failed: %s`, repositoryCode, testEAD, err))
+			return err
 		}
 
-		err = testCollectionDocSolrAddMessage(testEAD, eadToTest.CollectionDoc.SolrAddMessage)
-		if err != nil {
-			log.Println(err.Error())
-		}
+		return os.WriteFile(diffFile, []byte(diff), 0644)
+	})
+}
 
-		if eadToTest.Components == nil {
-			fmt.Println(testEAD + " has no components.  Skipping component tests")
+func main() {
+	defer exitOnPanic()
 
-			continue
-		}
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
 
-		componentIDs := []string{}
-		for _, component := range *eadToTest.Components {
-			componentIDs = append(componentIDs, component.ID)
-			err = testComponentSolrAddMessage(testEAD, component.ID,
-				component.SolrAddMessage)
-			if err != nil {
-				log.Println(err.Error())
-			}
-		}
+	commandName := os.Args[1]
+	if commandName == "-h" || commandName == "-help" || commandName == "help" {
+		usage()
+		os.Exit(exitOK)
+	}
 
-		err = testNoMissingComponents(testEAD, componentIDs)
-		if err != nil {
-			log.Println(err.Error())
+	for _, command := range commands {
+		if command.name == commandName {
+			os.Exit(command.run(os.Args[2:]))
 		}
 	}
+
+	log.Println(fmt.Sprintf(`Unknown command "%s"`, commandName))
+	usage()
+	os.Exit(exitUsage)
 }
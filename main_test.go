@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The EAD and golden files in testdata/, which were captured from
+// go-ead-indexer's own output, so the EAD passes.
+const testdataEAD = "test/tiny_001"
+
+// A golden file of the testdata EAD, and an edit which makes it mismatch
+// without changing its Content-Length.
+const testdataMismatchFileID = "tiny_001aspace_ref3"
+const testdataMismatchOld = `<field name="unittitle_ssm">Photographs</field>`
+const testdataMismatchNew = `<field name="unittitle_ssm">Photogrephs</field>`
+
+func appendToFile(t *testing.T, file string, text string) {
+	t.Helper()
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(file, append(contents, text...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Makes the golden file for `fileID` mismatch.
+func breakGoldenFile(t *testing.T, testEAD string, fileID string) {
+	t.Helper()
+
+	goldenFile := filepath.Join(goldenFilesDirPath, testEAD, fileID+goldenFileSuffix)
+	contents, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), testdataMismatchOld) {
+		t.Fatalf("%s does not contain %q", goldenFile, testdataMismatchOld)
+	}
+	contents = []byte(strings.Replace(string(contents), testdataMismatchOld, testdataMismatchNew, 1))
+	err = os.WriteFile(goldenFile, contents, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The path of the copy for `testEAD` of a testdata golden file: see
+// `setUpTestRun`.
+func getCopiedGoldenFilePath(testEAD string, goldenFile string) string {
+	if goldenFile == parseEADID(testdataEAD)+goldenFileSuffix {
+		goldenFile = parseEADID(testEAD) + goldenFileSuffix
+	}
+
+	return filepath.Join(goldenFilesDirPath, testEAD, goldenFile)
+}
+
+// Redirects stdout and stderr while `run` runs, and returns what was written
+// to them.
+func captureOutput(t *testing.T, run func()) (string, string) {
+	t.Helper()
+
+	stdoutFile, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutFile.Close()
+	stderrFile, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderrFile.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutFile, stderrFile
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+	}()
+	run()
+
+	stdoutBytes, err := os.ReadFile(stdoutFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderrBytes, err := os.ReadFile(stderrFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(stdoutBytes), string(stderrBytes)
+}
+
+func copyTestdataFile(t *testing.T, src string, dst string) {
+	t.Helper()
+
+	contents, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dst, contents, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Sets up a run of `numEADs` copies of the testdata EAD, test/tiny_001,
+// test/tiny_002, etc., each with its own copy of the golden files, and returns
+// their test EADs.  The EAD ID in the EAD file isn't changed, so the only golden
+// file which has to be renamed is the collection doc's.  Everything else the
+// run depends on is reset to its defaults, with the outputs in a temp dir.
+func setUpTestRun(t *testing.T, numEADs int) []string {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	eadDirPath = filepath.Join(tempDir, "eads")
+	goldenFilesDirPath = filepath.Join(tempDir, "http-requests")
+	overlayDirPath = filepath.Join(tempDir, defaultOverlayDirName)
+	setOutputDirPaths(flag.NewFlagSet("test", flag.ContinueOnError), filepath.Join(tempDir, "output"))
+
+	testdataGoldenFiles, err := os.ReadDir(filepath.Join("testdata", "http-requests", testdataEAD))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testEADs := []string{}
+	for i := 1; i <= numEADs; i++ {
+		testEAD := fmt.Sprintf("test/tiny_%03d", i)
+		testEADs = append(testEADs, testEAD)
+
+		copyTestdataFile(t, filepath.Join("testdata", "eads", testdataEAD+".xml"), getEADFilePath(testEAD))
+		for _, goldenFile := range testdataGoldenFiles {
+			copyTestdataFile(t, filepath.Join("testdata", "http-requests", testdataEAD, goldenFile.Name()),
+				getCopiedGoldenFilePath(testEAD, goldenFile.Name()))
+		}
+	}
+
+	err = clean()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shard = shardSpec{}
+	for _, err := range []error{
+		setFilters(filters{}),
+		setMassageRules("", nil),
+		setComparisonMode(""),
+		setFieldSemantics(nil),
+		setDiffOptions(nil, nil),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexerVersion = "test"
+	massageRulesHash, err = getMassageRulesHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedResults = map[string]eadResult{}
+	completedResults = map[string]eadResult{}
+	eadTimeout = 0
+	massageDiffs = false
+	writeGuards.Clear()
+
+	checkpointJournal, err = openJournal(completedResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		checkpointJournal.close()
+	})
+
+	return testEADs
+}
+
+func TestTestAllEADs(t *testing.T) {
+	const brokenTestEAD = "test/tiny_003"
+
+	for _, workers := range []int{1, 2, 5} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			testEADs := setUpTestRun(t, 5)
+			breakGoldenFile(t, brokenTestEAD, testdataMismatchFileID)
+
+			var results []eadResult
+			stdout, stderr := captureOutput(t, func() {
+				results = testAllEADs(testEADs, workers)
+			})
+
+			resultTestEADs := []string{}
+			for _, result := range results {
+				resultTestEADs = append(resultTestEADs, result.TestEAD)
+
+				expectedStatus := statusPassed
+				if result.TestEAD == brokenTestEAD {
+					expectedStatus = statusFailed
+				}
+				if result.Status != expectedStatus {
+					t.Errorf("%s: expected status %q, got %q: %s", result.TestEAD, expectedStatus,
+						result.Status, result.Stderr)
+				}
+				if result.Counts.ComponentsTested != 3 {
+					t.Errorf("%s: expected 3 components tested, got %d", result.TestEAD,
+						result.Counts.ComponentsTested)
+				}
+			}
+			if !slices.Equal(resultTestEADs, testEADs) {
+				t.Errorf("expected results for %q, got %q", testEADs, resultTestEADs)
+			}
+
+			// The buffered output is flushed in test EAD order, whatever order
+			// the workers finished in.
+			testingLines := []string{}
+			for _, line := range strings.Split(stdout, "\n") {
+				if _, testEAD, found := strings.Cut(line, " ] Testing "); found {
+					testingLines = append(testingLines, testEAD)
+				}
+			}
+			if !slices.Equal(testingLines, testEADs) {
+				t.Errorf("expected stdout to test %q in order, got %q", testEADs, testingLines)
+			}
+			if !strings.Contains(stderr, testdataMismatchFileID+" golden and actual values do not match") {
+				t.Errorf("expected stderr to report the mismatch, got %q", stderr)
+			}
+
+			for _, testEAD := range testEADs {
+				_, err := os.Stat(diffFile(testEAD, testdataMismatchFileID))
+				if hasDiffFile := err == nil; hasDiffFile != (testEAD == brokenTestEAD) {
+					t.Errorf("%s: expected diff file: %t, got %t", testEAD, testEAD == brokenTestEAD, hasDiffFile)
+				}
+			}
+		})
+	}
+}
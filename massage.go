@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The Go code for the builtin massage rules is kept in its own source file so
+// that incremental runs can detect changes to it: the hash of this file is one
+// of the inputs recorded for each test EAD, along with the hash of the rules
+// file.  See `getMassageRulesHash()`.
+const massageRulesSourceFile = "massage.go"
+
+// The shipped rules file, which reproduces the DLFA-243 massages.
+const defaultMassageRulesFileName = "massage-rules.json"
+
+// Values for `massageRule.Kind`.  "literal" and "regexp" rules replace every
+// occurrence of `Search` with `Replace`.  For "regexp" rules, `Replace` can
+// refer to submatches, as in `regexp.Regexp.ReplaceAllString`.  "builtin" rules
+// run the Go function named by `Search` in `builtinMassages`, for massages
+// which can't be expressed as a single replacement.
+const (
+	massageKindBuiltin = "builtin"
+	massageKindLiteral = "literal"
+	massageKindRegexp  = "regexp"
+)
+
+var massageKinds = []string{massageKindBuiltin, massageKindLiteral, massageKindRegexp}
+
+// For https://jira.nyu.edu/browse/DLFA-243
+// Can't use this:
+// &lt;em&gt;(?!.*&lt;em&gt;)(.*?)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;
+// ...because Go does not support negative lookahead.  We instead allow this
+// regexp to capture the largest match which would include the nested sub-match
+// we need to actually work with, and let a separate non-regexp-based process
+// take care of the rest.
+var emUnittitleMassage = regexp.MustCompile(`&lt;em&gt;(.*?)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;`)
+
+// Each massage returns the massaged golden value and the number of replacements
+// it made, for the massage trace.
+var builtinMassages = map[string]func(golden string, fileID string) (string, int, error){
+	"em-unittitle": func(golden string, fileID string) (string, int, error) {
+		massagedGolden, replacements := massageEmUnittitle(golden, fileID)
+		return massagedGolden, replacements, nil
+	},
+	"file-id-specific": massageGoldenFileIDSpecific,
+}
+
+// A golden file massage rule, as read from the rules file.  The rules are
+// applied in the order in which they appear in the file.  By default all of
+// them are applied, but the config file can name a subset -- e.g. to see which
+// golden file mismatches a particular rule is responsible for.
+type massageRule struct {
+	Description string           `json:"description"`
+	ID          string           `json:"id"`
+	Jira        string           `json:"jira"`
+	Kind        string           `json:"kind"`
+	Replace     string           `json:"replace"`
+	Scope       massageRuleScope `json:"scope"`
+	Search      string           `json:"search"`
+
+	massage func(golden string, fileID string) (string, int, error)
+}
+
+// The golden files a rule applies to.  An empty scope means all golden files.
+// Otherwise the rule applies to the golden files in any of the repositories, and
+// to any of the file IDs.
+type massageRuleScope struct {
+	FileIDs      []string `json:"file_ids"`
+	Repositories []string `json:"repositories"`
+}
+
+func (scope massageRuleScope) includes(repositoryCode string, fileID string) bool {
+	if len(scope.FileIDs) == 0 && len(scope.Repositories) == 0 {
+		return true
+	}
+
+	return slices.Contains(scope.Repositories, repositoryCode) || slices.Contains(scope.FileIDs, fileID)
+}
+
+type massageRulesFile struct {
+	Rules []massageRule `json:"rules"`
+}
+
+// Set by `setMassageRules`.
+var enabledMassageRules []massageRule
+var massageRules []massageRule
+var massageRulesFilePath string
+
+func getMassageRuleNames(rules []massageRule) []string {
+	names := []string{}
+	for _, rule := range rules {
+		names = append(names, rule.ID)
+	}
+
+	return names
+}
+
+// https://jira.nyu.edu/browse/DLFA-243
+// Also returns the trace of the rules which changed the golden value.
+func massageGolden(golden string, repositoryCode string, fileID string) (string, massageTrace, error) {
+	return massageGoldenVisitingSteps(golden, repositoryCode, fileID, nil)
+}
+
+// `visitStep`, if not nil, is called with the golden value before and after each
+// rule which changed it.
+func massageGoldenVisitingSteps(golden string, repositoryCode string, fileID string,
+	visitStep func(rule massageRule, replacements int, before string, after string)) (string, massageTrace, error) {
+	massagedGolden := golden
+	trace := massageTrace{}
+	for _, rule := range enabledMassageRules {
+		if !rule.Scope.includes(repositoryCode, fileID) {
+			continue
+		}
+
+		before := massagedGolden
+		var replacements int
+		var err error
+		massagedGolden, replacements, err = rule.massage(massagedGolden, fileID)
+		if err != nil {
+			return "", trace, fmt.Errorf(`massage rule "%s" failed: %s`, rule.ID, err)
+		}
+		if replacements > 0 {
+			trace = append(trace, massageStep{Replacements: replacements, RuleID: rule.ID})
+			if visitStep != nil {
+				visitStep(rule, replacements, before, massagedGolden)
+			}
+		}
+	}
+
+	return massagedGolden, trace, nil
+}
+
+func readMassageRulesFile(rulesFile string) ([]massageRule, error) {
+	loadedRulesFile := massageRulesFile{}
+
+	file, err := os.Open(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&loadedRulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for i := range loadedRulesFile.Rules {
+		rule := &loadedRulesFile.Rules[i]
+		err = setMassageRuleFunc(rule)
+		if err == nil && (rule.Description == "" || rule.Jira == "") {
+			err = errors.New("every rule needs a description and a Jira link")
+		}
+		if err == nil && slices.Contains(ids, rule.ID) {
+			err = errors.New("duplicate ID")
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`rule %d ("%s"): %s`, i+1, rule.ID, err)
+		}
+		ids = append(ids, rule.ID)
+	}
+
+	return loadedRulesFile.Rules, nil
+}
+
+func setMassageRuleFunc(rule *massageRule) error {
+	if rule.ID == "" {
+		return errors.New("no ID")
+	}
+	if rule.Search == "" {
+		return errors.New("no search string")
+	}
+
+	switch rule.Kind {
+	case massageKindBuiltin:
+		builtinMassage, ok := builtinMassages[rule.Search]
+		if !ok {
+			return fmt.Errorf(`unknown builtin massage "%s"`, rule.Search)
+		}
+		rule.massage = builtinMassage
+	case massageKindLiteral:
+		rule.massage = func(golden string, fileID string) (string, int, error) {
+			return strings.ReplaceAll(golden, rule.Search, rule.Replace), strings.Count(golden, rule.Search), nil
+		}
+	case massageKindRegexp:
+		searchRegexp, err := regexp.Compile(rule.Search)
+		if err != nil {
+			return err
+		}
+		rule.massage = func(golden string, fileID string) (string, int, error) {
+			return searchRegexp.ReplaceAllString(golden, rule.Replace),
+				len(searchRegexp.FindAllStringIndex(golden, -1)), nil
+		}
+	default:
+		return fmt.Errorf(`invalid kind "%s".  Valid kinds: %s`, rule.Kind, strings.Join(massageKinds, ", "))
+	}
+
+	return nil
+}
+
+// An empty `rulesFile` means the shipped rules file.  `nil` `names` means all
+// massage rules.  The rules are always applied in the order in which they are
+// defined, regardless of the order of `names`.
+func setMassageRules(rulesFile string, names []string) error {
+	massageRulesFilePath = rulesFile
+	if massageRulesFilePath == "" {
+		massageRulesFilePath = filepath.Join(rootPath, defaultMassageRulesFileName)
+	}
+
+	var err error
+	massageRules, err = readMassageRulesFile(massageRulesFilePath)
+	if err != nil {
+		return fmt.Errorf(`Massage rules file "%s" could not be read: %s`, massageRulesFilePath, err)
+	}
+	goldenFixes, err = readGoldenFixes(goldenFixesDir())
+	if err != nil {
+		return fmt.Errorf(`Golden fixes could not be read from "%s": %s`, goldenFixesDir(), err)
+	}
+
+	if names == nil {
+		enabledMassageRules = massageRules
+		return nil
+	}
+
+	allNames := getMassageRuleNames(massageRules)
+	for _, name := range names {
+		if !slices.Contains(allNames, name) {
+			return fmt.Errorf(`Unknown massage rule "%s".  Valid massage rules: %s`,
+				name, strings.Join(allNames, ", "))
+		}
+	}
+
+	enabledMassageRules = slices.DeleteFunc(slices.Clone(massageRules), func(rule massageRule) bool {
+		return !slices.Contains(names, rule.ID)
+	})
+
+	return nil
+}
+
+// DLFA-243: "Remove erroneously inserted EAD tags in Solr field content from golden files."
+// This is the second part of the massage.  The first part is dealt with in
+// `massageGoldenFileIDSpecific()`.
+// Example of what's being fixed here:
+// This:
+//
+//	<unittitle><title render="italic">Ayuda Medica Internacional</title>(photocopied clippings and notes) <title render="italic"></title></unittitle>
+//
+// ...is mangled by v1 indexer into:
+//
+//	<field name="unittitle_ssm">&lt;em&gt;Ayuda Medica Internacional&lt;/em&gt;(photocopied clippings and notes) &lt;em&gt;&amp;lt;/unittitle&amp;gt;&lt;/em&gt;</field>
+func massageEmUnittitle(golden string, fileID string) (string, int) {
+	massagedGolden := golden
+	replacements := 0
+
+	// This first set of matches might include the nested sub-match we actually
+	// care about.  Go does not support negative lookahead so we settle for this
+	// wide net casting and then use non-regexp-based processing to take care of
+	// the rest.
+	matches := emUnittitleMassage.FindStringSubmatch(massagedGolden)
+	if len(matches) == 2 {
+		// Isolate the rightmost match.
+		lastOccurrenceIndex := strings.LastIndex(matches[0], "&lt;em&gt")
+		lastOccurrence := matches[0][lastOccurrenceIndex:]
+		// Set up the replacement based on the rightmost match.
+		matches = emUnittitleMassage.FindStringSubmatch(lastOccurrence)
+		cleanString := "&lt;em&gt;&lt;/em&gt;" + matches[1]
+		// Do the replacement everywhere.
+		replacements = strings.Count(massagedGolden, lastOccurrence)
+		massagedGolden = strings.ReplaceAll(massagedGolden, lastOccurrence, cleanString)
+	} else {
+		// Do nothing.
+	}
+
+	return massagedGolden, replacements
+}
+
+// https://jira.nyu.edu/browse/DLFA-243
+// Applies the golden fix for the file ID, if there is one.  These changes
+// couldn't be handled by the code which deals with the general case for the
+// v1 indexer bug, so we brute force them: see `goldenFix`.
+func massageGoldenFileIDSpecific(golden string, fileID string) (string, int, error) {
+	fix, ok := goldenFixes[fileID]
+	if !ok {
+		return golden, 0, nil
+	}
+
+	return applyGoldenFix(golden, fileID, fix)
+}
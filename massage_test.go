@@ -0,0 +1,231 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The shipped rules file must reproduce the DLFA-243 massages exactly, which
+// were Go code before they were moved into massage-rules.json.
+func TestDefaultMassageRules(t *testing.T) {
+	err := setMassageRules("", nil)
+	if err != nil {
+		t.Fatalf("setMassageRules() of the shipped rules file failed: %s", err)
+	}
+
+	testCases := []struct {
+		name     string
+		fileID   string
+		golden   string
+		expected string
+	}{
+		{
+			name:     "nbsp-entities",
+			fileID:   "mos_2024",
+			golden:   `<field name="title_ssm">a&amp;nbsp;b</field>`,
+			expected: "<field name=\"title_ssm\">a\u00a0b</field>",
+		},
+		{
+			name:     "double-escaped-ampersands",
+			fileID:   "mos_2024",
+			golden:   `<field name="series_sim">Cars &amp;amp; Map</field>`,
+			expected: `<field name="series_sim">Cars &amp; Map</field>`,
+		},
+		{
+			name:     "em-unittitle",
+			fileID:   "mos_2024",
+			golden:   `<field name="unittitle_ssm">&lt;em&gt;Ayuda Medica Internacional&lt;/em&gt;(photocopied clippings and notes) &lt;em&gt;&amp;lt;/unittitle&amp;gt;&lt;/em&gt;</field>`,
+			expected: `<field name="unittitle_ssm">&lt;em&gt;Ayuda Medica Internacional&lt;/em&gt;(photocopied clippings and notes) &lt;em&gt;&lt;/em&gt;</field>`,
+		},
+		{
+			name:     "whitespace",
+			fileID:   "mos_2024",
+			golden:   "<field name=\"title_ssm\">\n  a \n\n b \u00a0</field>",
+			expected: `<field name="title_ssm">a b</field>`,
+		},
+		{
+			name:     "space-between-em-tags",
+			fileID:   "mos_2024",
+			golden:   `<field name="title_ssm">&lt;em&gt;a&lt;/em&gt; &lt;em&gt;b&lt;/em&gt;</field>`,
+			expected: `<field name="title_ssm">&lt;em&gt;a&lt;/em&gt;&lt;em&gt;b&lt;/em&gt;</field>`,
+		},
+		{
+			name:     "file-id-specific",
+			fileID:   "alba_218aspace_ref45",
+			golden:   `&lt;em&gt;(some with &amp;lt;title render="italic"/&amp;gt;annotations by Friedman)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;`,
+			expected: `&lt;em&gt;&lt;/em&gt;(some with &lt;em&gt;&lt;/em&gt;annotations by Friedman)`,
+		},
+		{
+			name:     "file ID without a golden fix",
+			fileID:   "alba_218aspace_ref46",
+			golden:   `&lt;em&gt;(some with &amp;lt;title render="italic"/&amp;gt;annotations by Friedman)&amp;lt;/unittitle&amp;gt;&lt;/em&gt;`,
+			expected: `&lt;em&gt;&lt;/em&gt;(some with &amp;lt;title render="italic"/&amp;gt;annotations by Friedman)`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			massagedGolden, _, err := massageGolden(testCase.golden, "alba", testCase.fileID)
+			if err != nil {
+				t.Fatalf("massageGolden() failed: %s", err)
+			}
+			if massagedGolden != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, massagedGolden)
+			}
+		})
+	}
+}
+
+func TestMassageTrace(t *testing.T) {
+	err := setMassageRules("", nil)
+	if err != nil {
+		t.Fatalf("setMassageRules() of the shipped rules file failed: %s", err)
+	}
+
+	_, trace, err := massageGolden("<field name=\"series_sim\">Cars &amp;amp;\nMap &amp;amp; Subway</field>",
+		"edip", "mos_2024")
+	if err != nil {
+		t.Fatalf("massageGolden() failed: %s", err)
+	}
+	expectedTrace := massageTrace{
+		{Replacements: 2, RuleID: "double-escaped-ampersands"},
+		{Replacements: 1, RuleID: "newlines"},
+	}
+	if !slices.Equal(trace, expectedTrace) {
+		t.Errorf("expected trace %v, got %v", expectedTrace, trace)
+	}
+}
+
+func TestMassageDiff(t *testing.T) {
+	err := setMassageRules("", nil)
+	if err != nil {
+		t.Fatalf("setMassageRules() of the shipped rules file failed: %s", err)
+	}
+
+	massageDiff, err := getMassageDiff("edip/mos_2024", "mos_2024",
+		`<add><doc><field name="series_sim">Cars &amp;amp; Map</field></doc></add>`)
+	if err != nil {
+		t.Fatalf("getMassageDiff() failed: %s", err)
+	}
+	for _, expected := range []string{
+		"### massage rule double-escaped-ampersands: 1 replacements",
+		`-    <field name="series_sim">Cars &amp;amp; Map</field>`,
+		`+    <field name="series_sim">Cars &amp; Map</field>`,
+	} {
+		if !strings.Contains(massageDiff, expected) {
+			t.Errorf("expected massage diff to contain %q, got:\n%s", expected, massageDiff)
+		}
+	}
+}
+
+// A fix whose search string is not in the golden value must fail rather than
+// silently do nothing.
+func TestGoldenFixSearchStringNotFound(t *testing.T) {
+	err := setMassageRules("", nil)
+	if err != nil {
+		t.Fatalf("setMassageRules() of the shipped rules file failed: %s", err)
+	}
+
+	_, _, err = massageGolden(`<field name="unittitle_ssm">George Seldes</field>`, "alba", "alba_236aspace_ref26")
+	if err == nil {
+		t.Fatal("expected an error for a golden fix which does not apply, got nil")
+	}
+	if !strings.Contains(err.Error(), "alba_236aspace_ref26.json replacement 1") {
+		t.Errorf("expected the error to name the fix, got %q", err)
+	}
+}
+
+// Only the fixes for the selected EADs and components which no tested golden
+// file used are stale.
+func TestGetStaleGoldenFixes(t *testing.T) {
+	t.Cleanup(func() {
+		setMassageRules("", nil)
+		setFilters(filters{})
+	})
+	fix := goldenFix{Description: "d", Jira: "j", Replacements: []goldenFixReplacement{{Search: "x"}}}
+	goldenFixes = map[string]goldenFix{
+		"tiny_001":             fix,
+		"tiny_001aspace_ref3":  fix,
+		"tiny_001aspace_ref8":  fix,
+		"tiny_001aspace_ref9":  fix,
+		"tiny_0010aspace_ref1": fix,
+		"other_001aspace_ref1": fix,
+	}
+	err := setFilters(filters{ExcludeComponents: []string{"ref8$"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []eadResult{{
+		GoldenFixes: getUsedGoldenFixes([]string{"tiny_001", "tiny_001aspace_ref1", "tiny_001aspace_ref3"}),
+		TestEAD:     "test/tiny_001",
+	}}
+	staleFixes := getStaleGoldenFixes(results, []string{"test/tiny_001"},
+		[]string{"test/tiny_001", "test/tiny_0010"})
+	expected := []string{"golden-fixes/tiny_001aspace_ref9.json"}
+	if !slices.Equal(staleFixes, expected) {
+		t.Errorf("expected %q, got %q", expected, staleFixes)
+	}
+}
+
+func TestReadMassageRulesFileErrors(t *testing.T) {
+	const validRule = `{"id": "a", "description": "d", "jira": "https://jira.nyu.edu/browse/DLFA-243", "kind": "literal", "search": "x"}`
+
+	testCases := []struct {
+		name          string
+		rules         string
+		expectedError string
+	}{
+		{
+			name:          "unknown kind",
+			rules:         `{"id": "a", "description": "d", "jira": "j", "kind": "xpath", "search": "x"}`,
+			expectedError: `invalid kind "xpath"`,
+		},
+		{
+			name:          "invalid regexp",
+			rules:         `{"id": "a", "description": "d", "jira": "j", "kind": "regexp", "search": "(?!x)"}`,
+			expectedError: "invalid or unsupported Perl syntax",
+		},
+		{
+			name:          "unknown builtin",
+			rules:         `{"id": "a", "description": "d", "jira": "j", "kind": "builtin", "search": "nope"}`,
+			expectedError: `unknown builtin massage "nope"`,
+		},
+		{
+			name:          "no Jira link",
+			rules:         `{"id": "a", "description": "d", "kind": "literal", "search": "x"}`,
+			expectedError: "needs a description and a Jira link",
+		},
+		{
+			name:          "duplicate ID",
+			rules:         validRule + ", " + validRule,
+			expectedError: `rule 2 ("a"): duplicate ID`,
+		},
+		{
+			name:          "unknown key",
+			rules:         `{"id": "a", "description": "d", "jira": "j", "kind": "literal", "search": "x", "files": []}`,
+			expectedError: `unknown field "files"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rulesFile := filepath.Join(t.TempDir(), "rules.json")
+			err := os.WriteFile(rulesFile, []byte(`{"rules": [`+testCase.rules+`]}`), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = readMassageRulesFile(rulesFile)
+			if err == nil {
+				t.Fatalf("expected error containing %q, got nil", testCase.expectedError)
+			}
+			if !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("expected error containing %q, got %q", testCase.expectedError, err)
+			}
+		})
+	}
+}
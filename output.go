@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// The outcome of testing a single EAD.  Results are saved in the cache file so
+// that incremental runs can reuse them.  The log output of the test is saved as
+// well, so that `merge` can reproduce the logs of an unsharded run.
+type eadResult struct {
+	Counts         eadCounts `json:"counts"`
+	CrashFile      string    `json:"crash_file,omitempty"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	Error          string    `json:"error,omitempty"`
+	// The file IDs of the tested golden files which have a golden fix.
+	GoldenFixes []string    `json:"golden_fixes,omitempty"`
+	Inputs      inputHashes `json:"inputs"`
+	// Keyed by file ID.  Only golden files which were changed by the massage
+	// rules have a trace.
+	MassageTraces map[string]massageTrace `json:"massage_traces,omitempty"`
+	// Keyed by file ID.  The size of the diff of each golden file which did not
+	// match.
+	MismatchDiffs map[string]diffStats `json:"mismatch_diffs,omitempty"`
+	// Overlay files which replaced the golden files of the tested file IDs.
+	Overlays []goldenOverlay `json:"overlays,omitempty"`
+	// Keyed by file ID.  The relaxations needed for the golden files which
+	// matched only because of relaxed comparison semantics.
+	RelaxedMatches map[string][]string `json:"relaxed_matches,omitempty"`
+	Status         string              `json:"status"`
+	Stderr         string              `json:"stderr"`
+	Stdout         string              `json:"stdout"`
+	TestEAD        string              `json:"test_ead"`
+}
+
+// Values for `eadResult.Status`.  "failed" means that the EAD was tested and at
+// least one test failed.  "errored" means that the EAD could not be completely
+// tested, because of a panic or some other error in the test execution itself.
+// "timeout" means that testing the EAD took longer than the `-timeout` limit.
+const (
+	statusErrored = "errored"
+	statusFailed  = "failed"
+	statusPassed  = "passed"
+	statusTimeout = "timeout"
+)
+
+// Buffered stdout and stderr for a single test EAD.  The stderr buffer is
+// written to via `logger`, which uses the same flags as the standard logger,
+// so flushed log lines look exactly like they did when we called `log.Println`
+// directly.
+type eadTestOutput struct {
+	logger *log.Logger
+	result eadResult
+	stderr bytes.Buffer
+	stdout bytes.Buffer
+}
+
+func newEADTestOutput(testEAD string) *eadTestOutput {
+	output := eadTestOutput{
+		result: eadResult{
+			Status:  statusPassed,
+			TestEAD: testEAD,
+		},
+	}
+	output.logger = log.New(&output.stderr, "", log.LstdFlags)
+
+	return &output
+}
+
+// Counts the result of testing a single Solr add message against its golden
+// file.  Execution errors aren't counted here: they are counted per EAD.
+func (output *eadTestOutput) countSolrAddMessageResult(fileID string, err error) {
+	mismatch := mismatchError{}
+	switch {
+	case err == nil:
+		output.result.Counts.Matched++
+	case errors.As(err, &goldenFileError{}):
+		output.result.Counts.GoldenFileErrors++
+	case errors.As(err, &missingGoldenError{}):
+		output.result.Counts.MissingGoldens++
+	case errors.As(err, &executionError{}):
+	case errors.As(err, &mismatch):
+		output.result.Counts.Mismatched++
+		output.result.Counts.MismatchedLinesDeleted += mismatch.stats.LinesDeleted
+		output.result.Counts.MismatchedLinesInserted += mismatch.stats.LinesInserted
+		if output.result.MismatchDiffs == nil {
+			output.result.MismatchDiffs = map[string]diffStats{}
+		}
+		output.result.MismatchDiffs[fileID] = mismatch.stats
+	default:
+		output.result.Counts.Mismatched++
+	}
+}
+
+func (output *eadTestOutput) recordMassageTrace(fileID string, trace massageTrace) {
+	if len(trace) == 0 {
+		return
+	}
+	if output.result.MassageTraces == nil {
+		output.result.MassageTraces = map[string]massageTrace{}
+	}
+	output.result.MassageTraces[fileID] = trace
+}
+
+func (output *eadTestOutput) recordRelaxedMatch(fileID string, relaxations []string) {
+	if len(relaxations) == 0 {
+		return
+	}
+	if output.result.RelaxedMatches == nil {
+		output.result.RelaxedMatches = map[string][]string{}
+	}
+	output.result.RelaxedMatches[fileID] = relaxations
+	fmt.Fprintf(&output.stdout, "%s golden and actual values match only with relaxed comparison: %s\n",
+		fileID, strings.Join(relaxations, ", "))
+}
+
+func (output *eadTestOutput) fail(message string) {
+	output.logger.Println(message)
+	if output.result.Status == statusPassed {
+		output.result.Status = statusFailed
+	}
+}
+
+func (output *eadTestOutput) flush() {
+	os.Stdout.Write(output.stdout.Bytes())
+	os.Stderr.Write(output.stderr.Bytes())
+}
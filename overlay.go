@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const defaultOverlayDirName = "golden-overlay"
+
+// HTTP headers which carry the metadata of a golden overlay file.  An overlay
+// file is a corrected capture of the request which the v1 indexer should have
+// sent, so it can carry its metadata the same way it carries everything else.
+const (
+	overlayReasonHeader   = "X-Golden-Overlay-Reason"
+	overlayReplacesHeader = "X-Golden-Overlay-Replaces"
+	overlayTicketHeader   = "X-Golden-Overlay-Ticket"
+)
+
+// A corrected golden file in the overlay directory, which takes priority over
+// the upstream capture it replaces.  `File` and `Replaces` are relative to the
+// overlay root and the golden files root, and are always the same path, because
+// the overlay mirrors the http-requests/[repository code]/[EAD ID]/ layout.
+type goldenOverlay struct {
+	File     string `json:"file"`
+	Reason   string `json:"reason"`
+	Replaces string `json:"replaces"`
+	Ticket   string `json:"ticket"`
+}
+
+// Set by `setInputConfig`.
+var overlayDirPath string
+
+func getOverlayFilePath(testEAD string, fileID string) string {
+	return filepath.Join(overlayDirPath, testEAD, fileID+goldenFileSuffix)
+}
+
+// Returns the overlays for the file IDs in `fileIDs` which have them.  Invalid
+// overlays are skipped: they have already been reported as golden file errors
+// by the tests which tried to use them.
+func getUsedOverlays(testEAD string, fileIDs []string) ([]goldenOverlay, error) {
+	usedOverlays := []goldenOverlay{}
+
+	dirEntries, err := os.ReadDir(filepath.Join(overlayDirPath, testEAD))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return usedOverlays, nil
+		}
+		return usedOverlays, err
+	}
+
+	for _, dirEntry := range dirEntries {
+		fileID, isGoldenFile := strings.CutSuffix(dirEntry.Name(), goldenFileSuffix)
+		if dirEntry.IsDir() || !isGoldenFile || !slices.Contains(fileIDs, fileID) {
+			continue
+		}
+
+		capture, err := os.ReadFile(getOverlayFilePath(testEAD, fileID))
+		if err != nil {
+			return usedOverlays, err
+		}
+		request, err := parseGoldenRequest(capture)
+		if err != nil {
+			continue
+		}
+		overlay, err := parseGoldenOverlay(testEAD, fileID, request.header)
+		if err != nil {
+			continue
+		}
+		usedOverlays = append(usedOverlays, overlay)
+	}
+
+	return usedOverlays, nil
+}
+
+func parseGoldenOverlay(testEAD string, fileID string, header http.Header) (goldenOverlay, error) {
+	relativePath := filepath.Join(testEAD, fileID+goldenFileSuffix)
+	overlay := goldenOverlay{
+		File:     relativePath,
+		Reason:   header.Get(overlayReasonHeader),
+		Replaces: header.Get(overlayReplacesHeader),
+		Ticket:   header.Get(overlayTicketHeader),
+	}
+
+	for _, required := range []struct{ header, value string }{
+		{overlayReasonHeader, overlay.Reason},
+		{overlayReplacesHeader, overlay.Replaces},
+		{overlayTicketHeader, overlay.Ticket},
+	} {
+		if strings.TrimSpace(required.value) == "" {
+			return overlay, fmt.Errorf("missing %s header", required.header)
+		}
+	}
+
+	if overlay.Replaces != relativePath {
+		return overlay, fmt.Errorf(`%s is "%s", but the overlay file is at "%s"`,
+			overlayReplacesHeader, overlay.Replaces, relativePath)
+	}
+	_, err := os.Stat(filepath.Join(goldenFilesDirPath, overlay.Replaces))
+	if err != nil {
+		return overlay, fmt.Errorf("replaced upstream golden file can't be read: %s", err)
+	}
+
+	return overlay, nil
+}
+
+func setOverlayDirPath(flagSet *flag.FlagSet, overlayDir string) {
+	if overlayDir == "" {
+		overlayDirPath = filepath.Join(rootPath, defaultOverlayDirName)
+		return
+	}
+
+	var err error
+	overlayDirPath, err = filepath.Abs(overlayDir)
+	if err != nil {
+		abortBadUsage(flagSet, fmt.Errorf(`Path "%s" is not a valid golden overlay root: %s`, overlayDir, err))
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Writes an overlay file for `fileID` which is a copy of its upstream golden
+// file with `headers` added.
+func writeTestOverlayFile(t *testing.T, testEAD string, fileID string, headers ...string) {
+	t.Helper()
+
+	upstreamCapture, err := os.ReadFile(filepath.Join(goldenFilesDirPath, testEAD, fileID+goldenFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestLine, rest, _ := strings.Cut(string(upstreamCapture), "\r\n")
+	capture := strings.Join(append(append([]string{requestLine}, headers...), rest), "\r\n")
+
+	overlayFile := getOverlayFilePath(testEAD, fileID)
+	err = os.MkdirAll(filepath.Dir(overlayFile), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(overlayFile, []byte(capture), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getTestOverlayHeaders(testEAD string, fileID string) []string {
+	return []string{
+		overlayReplacesHeader + ": " + filepath.Join(testEAD, fileID+goldenFileSuffix),
+		overlayReasonHeader + ": v1 bug",
+		overlayTicketHeader + ": DLFA-0",
+	}
+}
+
+func TestGetGoldenFilePath(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	upstreamFile := filepath.Join(goldenFilesDirPath, testEAD, testdataMismatchFileID+goldenFileSuffix)
+
+	if goldenFile := getGoldenFilePath(testEAD, testdataMismatchFileID); goldenFile != upstreamFile {
+		t.Errorf("without an overlay file: expected %q, got %q", upstreamFile, goldenFile)
+	}
+
+	writeTestOverlayFile(t, testEAD, testdataMismatchFileID, getTestOverlayHeaders(testEAD, testdataMismatchFileID)...)
+	overlayFile := getOverlayFilePath(testEAD, testdataMismatchFileID)
+	if goldenFile := getGoldenFilePath(testEAD, testdataMismatchFileID); goldenFile != overlayFile {
+		t.Errorf("with an overlay file: expected %q, got %q", overlayFile, goldenFile)
+	}
+}
+
+func TestParseGoldenOverlay(t *testing.T) {
+	const testEAD = "test/tiny_001"
+	const fileID = testdataMismatchFileID
+	relativePath := filepath.Join(testEAD, fileID+goldenFileSuffix)
+
+	testCases := []struct {
+		name          string
+		headers       []string
+		expectedError string
+	}{
+		{
+			name:    "valid",
+			headers: getTestOverlayHeaders(testEAD, fileID),
+		},
+		{
+			name:          "missing reason",
+			headers:       getTestOverlayHeaders(testEAD, fileID)[0:1],
+			expectedError: "missing " + overlayReasonHeader + " header",
+		},
+		{
+			name: "blank ticket",
+			headers: []string{
+				overlayReplacesHeader + ": " + relativePath,
+				overlayReasonHeader + ": v1 bug",
+				overlayTicketHeader + ":  ",
+			},
+			expectedError: "missing " + overlayTicketHeader + " header",
+		},
+		{
+			name: "replaces another golden file",
+			headers: []string{
+				overlayReplacesHeader + ": " + filepath.Join(testEAD, "tiny_001aspace_ref1"+goldenFileSuffix),
+				overlayReasonHeader + ": v1 bug",
+				overlayTicketHeader + ": DLFA-0",
+			},
+			expectedError: overlayReplacesHeader + ` is "test/tiny_001/tiny_001aspace_ref1-add.txt", but the ` +
+				`overlay file is at "test/tiny_001/tiny_001aspace_ref3-add.txt"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setUpTestRun(t, 1)
+			writeTestOverlayFile(t, testEAD, fileID, testCase.headers...)
+
+			capture, err := os.ReadFile(getOverlayFilePath(testEAD, fileID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			request, err := parseGoldenRequest(capture)
+			if err != nil {
+				t.Fatalf("parseGoldenRequest() failed: %s", err)
+			}
+			overlay, err := parseGoldenOverlay(testEAD, fileID, request.header)
+			if testCase.expectedError == "" {
+				expected := goldenOverlay{File: relativePath, Reason: "v1 bug", Replaces: relativePath, Ticket: "DLFA-0"}
+				if err != nil {
+					t.Errorf("expected a valid overlay, got %s", err)
+				} else if overlay != expected {
+					t.Errorf("expected %+v, got %+v", expected, overlay)
+				}
+			} else if err == nil || err.Error() != testCase.expectedError {
+				t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestParseGoldenOverlayWithoutUpstreamFile(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	writeTestOverlayFile(t, testEAD, testdataMismatchFileID, getTestOverlayHeaders(testEAD, testdataMismatchFileID)...)
+	err := os.Remove(filepath.Join(goldenFilesDirPath, testEAD, testdataMismatchFileID+goldenFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture, err := os.ReadFile(getOverlayFilePath(testEAD, testdataMismatchFileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := parseGoldenRequest(capture)
+	if err != nil {
+		t.Fatalf("parseGoldenRequest() failed: %s", err)
+	}
+	_, err = parseGoldenOverlay(testEAD, testdataMismatchFileID, request.header)
+	if err == nil || !strings.HasPrefix(err.Error(), "replaced upstream golden file can't be read: ") {
+		t.Errorf("expected the missing upstream file to be reported, got %v", err)
+	}
+}
+
+// Only valid overlays for the file IDs which were tested are reported.
+func TestGetUsedOverlays(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+
+	overlays, err := getUsedOverlays(testEAD, []string{testdataMismatchFileID})
+	if err != nil {
+		t.Fatalf("getUsedOverlays() without an overlay directory failed: %s", err)
+	}
+	if len(overlays) != 0 {
+		t.Errorf("expected no overlays, got %+v", overlays)
+	}
+
+	writeTestOverlayFile(t, testEAD, testdataMismatchFileID, getTestOverlayHeaders(testEAD, testdataMismatchFileID)...)
+	writeTestOverlayFile(t, testEAD, "tiny_001aspace_ref1", getTestOverlayHeaders(testEAD, "tiny_001aspace_ref1")...)
+	// Invalid: no metadata.
+	writeTestOverlayFile(t, testEAD, "tiny_001aspace_ref2")
+
+	overlays, err = getUsedOverlays(testEAD, []string{"tiny_001aspace_ref2", testdataMismatchFileID})
+	if err != nil {
+		t.Fatalf("getUsedOverlays() failed: %s", err)
+	}
+	relativePath := filepath.Join(testEAD, testdataMismatchFileID+goldenFileSuffix)
+	expected := []goldenOverlay{{File: relativePath, Reason: "v1 bug", Replaces: relativePath, Ticket: "DLFA-0"}}
+	if !reflect.DeepEqual(overlays, expected) {
+		t.Errorf("expected %+v, got %+v", expected, overlays)
+	}
+}
+
+// A run uses an overlay file instead of the upstream golden file it replaces,
+// and records it in the result.
+func TestTestSingleEADWithOverlay(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	breakGoldenFile(t, testEAD, testdataMismatchFileID)
+	// The overlay is a copy of the broken golden file, fixed.
+	writeTestOverlayFile(t, testEAD, testdataMismatchFileID, getTestOverlayHeaders(testEAD, testdataMismatchFileID)...)
+	replaceInFile(t, getOverlayFilePath(testEAD, testdataMismatchFileID), testdataMismatchNew, testdataMismatchOld)
+
+	output := testSingleEAD(testEAD)
+	if output.result.Status != statusPassed {
+		t.Fatalf("expected status %q, got %q: %s", statusPassed, output.result.Status, output.stderr.String())
+	}
+	if len(output.result.Overlays) != 1 || output.result.Overlays[0].Ticket != "DLFA-0" {
+		t.Errorf("expected the overlay to be recorded, got %+v", output.result.Overlays)
+	}
+}
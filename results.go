@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const runResultsFileName = "results.json"
+
+// The results of every EAD tested by a run, in test EAD order, including those
+// skipped because of `-incremental` or `-resume`.  Each shard of a sharded run
+// writes its own, and `merge` combines them.
+// `ElapsedSeconds` is the wall clock time of the run.  For a merged run, it's
+// that of the slowest shard, on the assumption that the shards ran in parallel.
+type runResults struct {
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// IDs of the enabled massage rules, for the massage rules report.
+	MassageRules []string    `json:"massage_rules"`
+	Results      []eadResult `json:"results"`
+	Shard        string      `json:"shard"`
+	// See `getStaleGoldenFixes`.
+	StaleGoldenFixes []string `json:"stale_golden_fixes,omitempty"`
+}
+
+func runResultsFile() string {
+	return runResultsFileForOutputDir(outputDirPath)
+}
+
+func runResultsFileForOutputDir(outputDir string) string {
+	return filepath.Join(outputDir, "tmp", runResultsFileName)
+}
+
+func readRunResults(outputDir string) (runResults, error) {
+	results := runResults{}
+
+	bytes, err := os.ReadFile(runResultsFileForOutputDir(outputDir))
+	if err != nil {
+		return results, err
+	}
+
+	err = json.Unmarshal(bytes, &results)
+
+	return results, err
+}
+
+func writeRunResults(results runResults) error {
+	bytes, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(runResultsFile()), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(runResultsFile(), bytes, 0644)
+}
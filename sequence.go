@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/nyulibraries/go-ead-indexer/pkg/ead"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Kinds of Solr update requests sent for an EAD.  Both the v1 indexer and
+// go-ead-indexer's `index.IndexEADFile` delete the old collection doc and
+// components, add the collection doc, add the components one request at a
+// time, and commit.  go-ead-indexer rolls back instead of committing if a
+// request fails.
+const (
+	requestDelete           = "delete"
+	requestAddCollectionDoc = "add collection doc"
+	requestAddComponent     = "add component"
+	requestCommit           = "commit"
+	requestRollback         = "rollback"
+)
+
+// The order in which the golden captures are put: see
+// `readGoldenRequestSequence`.
+var requestKindOrder = []string{requestDelete, requestAddCollectionDoc, requestAddComponent,
+	requestCommit, requestRollback}
+
+type solrUpdateRequest struct {
+	kind string
+	// The queries or IDs of a delete request.
+	target string
+}
+
+// A step of a request sequence: a single request, or a run of consecutive
+// component add requests.  The v1 indexer's captures can't show in which
+// order it added the components, and the components themselves are checked
+// by `testNoMissingComponents` and the add message tests, so only the number
+// and position of the runs are compared, not their lengths.
+type requestStep struct {
+	count int
+	solrUpdateRequest
+}
+
+func (step requestStep) String() string {
+	switch step.kind {
+	case requestAddComponent:
+		return fmt.Sprintf("add %d components", step.count)
+	case requestDelete:
+		return fmt.Sprintf("%s %s", step.kind, step.target)
+	default:
+		return step.kind
+	}
+}
+
+// A Solr delete message, which can delete by query, by ID, or both.
+type solrDeleteMessage struct {
+	IDs     []string `xml:"id"`
+	Queries []string `xml:"query"`
+}
+
+// Mirrors `index.IndexEADFile`, which deletes by query on the EAD ID from the
+// EAD itself rather than from the file name, adds the collection doc, adds the
+// components one request at a time, and commits.  The EAD has already been
+// parsed for the add message tests, so `index.IndexEADFile` isn't run again.
+// It would panic if the EAD has no `<eadid>`, which is reported as a mismatch.
+// It also panics if `EAD.Components` is nil, so the sequence isn't checked for
+// EADs without components: see `testSingleEAD`.
+func getIndexerRequestSequence(eadToTest ead.EAD) ([]solrUpdateRequest, error) {
+	if len(eadToTest.CollectionDoc.Parts.EADID.Values) == 0 {
+		return nil, errors.New("go-ead-indexer would not send a delete request: the EAD has no <eadid>")
+	}
+
+	requests := []solrUpdateRequest{
+		{kind: requestDelete, target: fmt.Sprintf(`ead_ssi:"%s"`, eadToTest.CollectionDoc.Parts.EADID.Values[0])},
+		{kind: requestAddCollectionDoc},
+	}
+	if eadToTest.Components != nil {
+		for range *eadToTest.Components {
+			requests = append(requests, solrUpdateRequest{kind: requestAddComponent})
+		}
+	}
+	requests = append(requests, solrUpdateRequest{kind: requestCommit})
+
+	return requests, nil
+}
+
+// Collapses each run of consecutive component adds into a single step.
+func getRequestSteps(requests []solrUpdateRequest) []requestStep {
+	steps := []requestStep{}
+	for _, request := range requests {
+		if request.kind == requestAddComponent && len(steps) > 0 &&
+			steps[len(steps)-1].kind == requestAddComponent {
+
+			steps[len(steps)-1].count++
+			continue
+		}
+		steps = append(steps, requestStep{count: 1, solrUpdateRequest: request})
+	}
+
+	return steps
+}
+
+func joinRequestSteps(steps []requestStep) string {
+	descriptions := []string{}
+	for _, step := range steps {
+		descriptions = append(descriptions, step.String())
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// The golden captures don't record the order in which they were captured, and
+// their modification times don't survive a git clone, so they are put in
+// `requestKindOrder` order, then by file name.  That is the order in which the
+// v1 indexer and go-ead-indexer send them, so the sequences are compared by the
+// kinds of requests in each phase, the number of deletes, collection doc adds,
+// commits, and rollbacks, and the targets of the deletes.
+//
+// The add requests are classified by file name, because the add message tests
+// already parse them and report the ones which aren't adds.  All other
+// captures are parsed and classified by the root element of the body.
+func readGoldenRequestSequence(testEAD string) ([]solrUpdateRequest, error) {
+	type goldenCapture struct {
+		name    string
+		request solrUpdateRequest
+	}
+	captures := []goldenCapture{}
+
+	goldenFileIDs, err := readGoldenFileIDs(testEAD)
+	if err != nil {
+		return nil, err
+	}
+
+	goldenFilesDir := filepath.Join(goldenFilesDirPath, testEAD)
+	dirEntries, err := os.ReadDir(goldenFilesDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != ".txt" {
+			continue
+		}
+		capture := goldenCapture{name: dirEntry.Name()}
+
+		goldenFileID := strings.TrimSuffix(dirEntry.Name(), goldenFileSuffix)
+		if slices.Contains(goldenFileIDs, goldenFileID) {
+			capture.request.kind = requestAddComponent
+			if goldenFileID == parseEADID(testEAD) {
+				capture.request.kind = requestAddCollectionDoc
+			}
+			captures = append(captures, capture)
+			continue
+		}
+
+		goldenFilePath := filepath.Join(goldenFilesDir, dirEntry.Name())
+		contents, err := os.ReadFile(goldenFilePath)
+		if err != nil {
+			return nil, err
+		}
+		request, err := parseGoldenRequest(contents)
+		if err != nil {
+			return nil, newGoldenFileError("Golden file error in %s: %s", goldenFilePath, err)
+		}
+
+		switch request.bodyRoot {
+		case "commit":
+			capture.request.kind = requestCommit
+		case "delete":
+			deleteMessage := solrDeleteMessage{}
+			err = xml.Unmarshal([]byte(request.body), &deleteMessage)
+			if err != nil {
+				return nil, newGoldenFileError("Golden file error in %s: invalid delete message: %s",
+					goldenFilePath, err)
+			}
+			capture.request.kind = requestDelete
+			capture.request.target = strings.Join(append(deleteMessage.Queries, deleteMessage.IDs...), ", ")
+		case "rollback":
+			capture.request.kind = requestRollback
+		default:
+			return nil, newGoldenFileError("Golden file error in %s: unexpected <%s> request",
+				goldenFilePath, request.bodyRoot)
+		}
+		captures = append(captures, capture)
+	}
+
+	slices.SortFunc(captures, func(a goldenCapture, b goldenCapture) int {
+		return cmp.Or(
+			slices.Index(requestKindOrder, a.request.kind)-slices.Index(requestKindOrder, b.request.kind),
+			strings.Compare(a.name, b.name),
+		)
+	})
+
+	requests := []solrUpdateRequest{}
+	for _, capture := range captures {
+		requests = append(requests, capture.request)
+	}
+
+	return requests, nil
+}
+
+// Checks that go-ead-indexer would send the same Solr update requests for the
+// EAD as were captured from the v1 indexer, in the order described in
+// `readGoldenRequestSequence`.  Deletes,
+// collection doc adds, commits, and rollbacks are compared one by one, with
+// the targets of the deletes, and the component adds as runs: see
+// `requestStep`.
+func testRequestSequence(testEAD string, eadToTest ead.EAD) error {
+	goldenRequests, err := readGoldenRequestSequence(testEAD)
+	if err != nil {
+		if errors.As(err, &goldenFileError{}) {
+			return err
+		}
+		return newExecutionError(`readGoldenRequestSequence("%s") failed: %s`, testEAD, err)
+	}
+
+	indexerRequests, err := getIndexerRequestSequence(eadToTest)
+	if err != nil {
+		return fmt.Errorf("Solr update request sequence for %s can't be checked: %s", testEAD, err)
+	}
+
+	goldenSteps := getRequestSteps(goldenRequests)
+	indexerSteps := getRequestSteps(indexerRequests)
+	if !slices.EqualFunc(goldenSteps, indexerSteps, func(a requestStep, b requestStep) bool {
+		return a.solrUpdateRequest == b.solrUpdateRequest
+	}) {
+		return fmt.Errorf("Solr update request sequence for %s does not match go-ead-indexer's:\n"+
+			"    golden:         %s\n"+
+			"    go-ead-indexer: %s",
+			testEAD, joinRequestSteps(goldenSteps), joinRequestSteps(indexerSteps))
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"github.com/nyulibraries/go-ead-indexer/pkg/ead"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func replaceInFile(t *testing.T, file string, old string, new string) {
+	t.Helper()
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), old) {
+		t.Fatalf("%s does not contain %q", file, old)
+	}
+	err = os.WriteFile(file, []byte(strings.ReplaceAll(string(contents), old, new)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The golden captures are put in request kind order, whatever their
+// modification times are.
+func TestTestRequestSequence(t *testing.T) {
+	const deleteFile = "tiny_001-delete.txt"
+	const commitFile = "tiny_001-commit-add.txt"
+
+	testCases := []struct {
+		name             string
+		change           func(t *testing.T, testEAD string)
+		expectedSequence string
+	}{
+		{
+			name:   "golden files",
+			change: func(t *testing.T, testEAD string) {},
+		},
+		{
+			name: "modification times in reverse order",
+			change: func(t *testing.T, testEAD string) {
+				dirEntries, err := os.ReadDir(filepath.Join(goldenFilesDirPath, testEAD))
+				if err != nil {
+					t.Fatal(err)
+				}
+				modTime := time.Now().Add(-time.Hour)
+				for _, dirEntry := range slices.Backward(dirEntries) {
+					err = os.Chtimes(filepath.Join(goldenFilesDirPath, testEAD, dirEntry.Name()), modTime, modTime)
+					if err != nil {
+						t.Fatal(err)
+					}
+					modTime = modTime.Add(time.Second)
+				}
+			},
+		},
+		{
+			name: "duplicate delete",
+			change: func(t *testing.T, testEAD string) {
+				copyTestdataFile(t, getCopiedGoldenFilePath(testEAD, deleteFile),
+					getCopiedGoldenFilePath(testEAD, "tiny_001-delete-again.txt"))
+			},
+			expectedSequence: `delete ead_ssi:"tiny_001", delete ead_ssi:"tiny_001", add collection doc, ` +
+				"add 3 components, commit",
+		},
+		{
+			name: "wrong delete target",
+			change: func(t *testing.T, testEAD string) {
+				replaceInFile(t, getCopiedGoldenFilePath(testEAD, deleteFile), `"tiny_001"`, `"tiny_009"`)
+			},
+			expectedSequence: `delete ead_ssi:"tiny_009", add collection doc, add 3 components, commit`,
+		},
+		{
+			name: "missing commit",
+			change: func(t *testing.T, testEAD string) {
+				err := os.Remove(getCopiedGoldenFilePath(testEAD, commitFile))
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectedSequence: `delete ead_ssi:"tiny_001", add collection doc, add 3 components`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+			testCase.change(t, testEAD)
+
+			eadXML, err := getEADValue(testEAD)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eadToTest, err := ead.New(parseRepositoryCode(testEAD), eadXML)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = testRequestSequence(testEAD, eadToTest)
+			if testCase.expectedSequence == "" {
+				if err != nil {
+					t.Errorf("expected the sequences to match, got %s", err)
+				}
+			} else if err == nil || errors.As(err, &executionError{}) ||
+				!strings.Contains(err.Error(), "golden:         "+testCase.expectedSequence+"\n") {
+
+				t.Errorf("expected a mismatch with golden sequence %q, got %v", testCase.expectedSequence, err)
+			}
+		})
+	}
+}
+
+// An EAD without components passes without a request sequence check, since
+// `index.IndexEADFile` would panic before sending any requests.
+func TestTestSingleEADWithoutComponents(t *testing.T) {
+	testEAD := setUpTestRun(t, 1)[0]
+	replaceInFile(t, getEADFilePath(testEAD), "<c ", "<odd ")
+	replaceInFile(t, getEADFilePath(testEAD), "</c>", "</odd>")
+
+	output := testSingleEAD(testEAD)
+	if output.result.Status != statusPassed {
+		t.Fatalf("expected status %q, got %q: %s", statusPassed, output.result.Status, output.stderr.String())
+	}
+	if output.result.Counts.SequenceMismatches != 0 || output.result.Counts.Matched != 1 {
+		t.Errorf("expected only the collection doc to be tested, got %+v", output.result.Counts)
+	}
+	if !strings.Contains(output.stdout.String(), testEAD+" has no components.") {
+		t.Errorf("expected the skipped tests to be reported, got %q", output.stdout.String())
+	}
+	if _, err := os.Stat(crashFile(testEAD)); err == nil {
+		t.Errorf("expected no crash file")
+	}
+}
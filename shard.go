@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shard `index` of `count`, 1-based.  The zero value means no sharding.
+type shardSpec struct {
+	count int
+	index int
+}
+
+// Assigning EADs to shards by a hash of the test EAD rather than by position in
+// the sorted list means that adding or removing an EAD doesn't move any other
+// EADs to a different shard.  FNV-1a is fast and spreads the test EAD strings
+// evenly enough to keep the shards balanced.
+func (s *shardSpec) contains(testEAD string) bool {
+	if s.count == 0 {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(testEAD))
+
+	return int(hash.Sum32()%uint32(s.count)) == s.index-1
+}
+
+func (s *shardSpec) Set(value string) error {
+	indexString, countString, found := strings.Cut(value, "/")
+	if !found {
+		return fmt.Errorf(`shard must be of the form "i/n"`)
+	}
+
+	index, err := strconv.Atoi(indexString)
+	if err != nil {
+		return fmt.Errorf(`invalid shard index "%s"`, indexString)
+	}
+	count, err := strconv.Atoi(countString)
+	if err != nil {
+		return fmt.Errorf(`invalid shard count "%s"`, countString)
+	}
+	if count < 1 || index < 1 || index > count {
+		return fmt.Errorf("shard index must be between 1 and %d", count)
+	}
+
+	s.count = count
+	s.index = index
+
+	return nil
+}
+
+func (s *shardSpec) String() string {
+	if s.count == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// Copies all files under `srcDir` into `destDir`.  Shards test disjoint sets of
+// EADs, so a file that already exists in `destDir` means that something is
+// wrong with the shard outputs.
+func copyTree(srcDir string, destDir string) error {
+	return filepath.WalkDir(srcDir, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == srcDir {
+				return nil
+			}
+			return err
+		}
+		if dirEntry.IsDir() || dirEntry.Name() == ".gitkeep" {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		destFile := filepath.Join(destDir, relativePath)
+		if _, err = os.Stat(destFile); err == nil {
+			return fmt.Errorf(`"%s" is in the outputs of more than one shard`, relativePath)
+		}
+
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(destFile), 0755)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(destFile, bytes, 0644)
+	})
+}
+
+// Combines the outputs of all the shards of a sharded run into `outputDirPath`,
+// which ends up looking as if the run had been done in a single process: the
+// crashes/, diffs/, and tmp/actual/ trees are the union of the shard trees, the
+// results, cache, checkpoint journal, and summary cover every EAD, and new
+// stdout and stderr logs are written with each EAD's log lines in test EAD
+// order.  Returns the summary of the merged results, or an error if the shard
+// outputs don't make up a complete run, in which case nothing is written.
+func merge(flagSet *flag.FlagSet, outputDir string, shardDirs []string) (runSummary, error) {
+	if len(shardDirs) == 0 {
+		abortBadUsage(flagSet, fmt.Errorf("No shard output directories specified"))
+	}
+
+	setOutputDirPaths(flagSet, outputDir)
+
+	for _, shardDir := range shardDirs {
+		absShardDir, err := filepath.Abs(shardDir)
+		if err != nil || absShardDir == outputDirPath {
+			abortBadUsage(flagSet, fmt.Errorf(`Shard output directory "%s" can't be the merge output directory`,
+				shardDir))
+		}
+	}
+
+	mergedResults, err := mergeRunResults(shardDirs)
+	if err != nil {
+		return runSummary{}, err
+	}
+
+	err = clean()
+	if err != nil {
+		log.Panic("clean() error: " + err.Error())
+	}
+
+	for _, shardDir := range shardDirs {
+		err = copyTree(filepath.Join(shardDir, "crashes"), crashesDirPath)
+		if err != nil {
+			log.Panic(fmt.Sprintf(`Merging crashes/ from "%s" failed: %s`, shardDir, err))
+		}
+		err = copyTree(filepath.Join(shardDir, "diffs"), diffsDirPath)
+		if err != nil {
+			log.Panic(fmt.Sprintf(`Merging diffs/ from "%s" failed: %s`, shardDir, err))
+		}
+		err = copyTree(filepath.Join(shardDir, "tmp", "actual"), tmpFilesDirPath)
+		if err != nil {
+			log.Panic(fmt.Sprintf(`Merging tmp/actual/ from "%s" failed: %s`, shardDir, err))
+		}
+	}
+
+	cache := map[string]eadResult{}
+	for _, result := range mergedResults.Results {
+		cache[result.TestEAD] = result
+	}
+	err = writeCache(cache)
+	if err != nil {
+		log.Panic("writeCache() error: " + err.Error())
+	}
+
+	mergedJournal, err := openJournal(cache)
+	if err != nil {
+		log.Panic("openJournal() error: " + err.Error())
+	}
+	mergedJournal.close()
+
+	err = writeRunResults(mergedResults)
+	if err != nil {
+		log.Panic("writeRunResults() error: " + err.Error())
+	}
+
+	err = writeMergedLogs(mergedResults.Results)
+	if err != nil {
+		log.Panic("writeMergedLogs() error: " + err.Error())
+	}
+
+	summary := summarize(mergedResults)
+	err = writeSummaryFile(summary)
+	if err != nil {
+		log.Panic("writeSummaryFile() error: " + err.Error())
+	}
+
+	err = writeMassageRulesReportFile(getMassageRulesReport(mergedResults))
+	if err != nil {
+		log.Panic("writeMassageRulesReportFile() error: " + err.Error())
+	}
+
+	return summary, nil
+}
+
+// Checks that the shard outputs are for a complete set of shards `1/n` through
+// `n/n` which were all run against the same indexer version, massage rules,
+// component filters, comparison settings, and diff options, and returns their
+// results in test EAD order.
+func mergeRunResults(shardDirs []string) (runResults, error) {
+	mergedResults := runResults{Results: []eadResult{}}
+	seenShards := map[string]string{}
+	shardCount := 0
+	var firstInputs *inputHashes
+
+	for _, shardDir := range shardDirs {
+		shardResults, err := readRunResults(shardDir)
+		if err != nil {
+			return runResults{}, fmt.Errorf(`Reading results for shard output directory "%s" failed: %s`,
+				shardDir, err)
+		}
+
+		shardOfDir := shardSpec{}
+		err = shardOfDir.Set(shardResults.Shard)
+		if err != nil {
+			return runResults{}, fmt.Errorf(`"%s" is not the output of a sharded run: %s`, shardDir, err)
+		}
+		if shardCount == 0 {
+			shardCount = shardOfDir.count
+		} else if shardOfDir.count != shardCount {
+			return runResults{}, fmt.Errorf(`"%s" is shard %s, but other shards are out of %d`,
+				shardDir, shardResults.Shard, shardCount)
+		}
+		if otherShardDir, ok := seenShards[shardResults.Shard]; ok {
+			return runResults{}, fmt.Errorf(`"%s" and "%s" are both shard %s`,
+				otherShardDir, shardDir, shardResults.Shard)
+		}
+		seenShards[shardResults.Shard] = shardDir
+
+		for _, result := range shardResults.Results {
+			// Input hashing failed for this EAD, so there's nothing to compare.
+			if result.Inputs.IndexerVersion == "" {
+				continue
+			}
+			if firstInputs == nil {
+				firstInputs = &result.Inputs
+			} else if result.Inputs.IndexerVersion != firstInputs.IndexerVersion ||
+				result.Inputs.MassageRules != firstInputs.MassageRules ||
+				result.Inputs.ComponentFilters != firstInputs.ComponentFilters ||
+				result.Inputs.Comparison != firstInputs.Comparison ||
+				result.Inputs.Diff != firstInputs.Diff {
+				return runResults{}, fmt.Errorf(`Shard %s was not run with the same indexer version, massage rules, component filters, comparison settings, and diff options as the other shards`,
+					shardResults.Shard)
+			}
+		}
+
+		mergedResults.ElapsedSeconds = max(mergedResults.ElapsedSeconds, shardResults.ElapsedSeconds)
+		// The same for all shards, because the massage rules hashes match.
+		mergedResults.MassageRules = shardResults.MassageRules
+		mergedResults.Results = append(mergedResults.Results, shardResults.Results...)
+		// Each shard only reports the stale fixes for its own EADs.
+		mergedResults.StaleGoldenFixes = append(mergedResults.StaleGoldenFixes, shardResults.StaleGoldenFixes...)
+	}
+
+	if len(seenShards) != shardCount {
+		missingShards := []string{}
+		for i := 1; i <= shardCount; i++ {
+			shardString := fmt.Sprintf("%d/%d", i, shardCount)
+			if _, ok := seenShards[shardString]; !ok {
+				missingShards = append(missingShards, shardString)
+			}
+		}
+		return runResults{}, fmt.Errorf("Missing output directories for shards: %s",
+			strings.Join(missingShards, ", "))
+	}
+
+	slices.Sort(mergedResults.StaleGoldenFixes)
+	slices.SortFunc(mergedResults.Results, func(a eadResult, b eadResult) int {
+		return strings.Compare(a.TestEAD, b.TestEAD)
+	})
+	for i := 1; i < len(mergedResults.Results); i++ {
+		if mergedResults.Results[i].TestEAD == mergedResults.Results[i-1].TestEAD {
+			return runResults{}, fmt.Errorf(`"%s" was tested by more than one shard`,
+				mergedResults.Results[i].TestEAD)
+		}
+	}
+
+	return mergedResults, nil
+}
+
+// Uses the same naming scheme as diff.sh, with a "_merged" suffix.
+func writeMergedLogs(mergedResults []eadResult) error {
+	logsDir := filepath.Join(outputDirPath, "logs")
+	err := os.MkdirAll(logsDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	stdout := strings.Builder{}
+	stderr := strings.Builder{}
+	for _, result := range mergedResults {
+		stdout.WriteString(result.Stdout)
+		stderr.WriteString(result.Stderr)
+	}
+
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	err = os.WriteFile(filepath.Join(logsDir, timestamp+"_merged.log"),
+		[]byte(stdout.String()), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(logsDir, timestamp+"_merged_stderr.log"),
+		[]byte(stderr.String()), 0644)
+}
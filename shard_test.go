@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShardSpecSet(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      shardSpec
+		expectedError string
+	}{
+		{name: "first shard", value: "1/3", expected: shardSpec{count: 3, index: 1}},
+		{name: "last shard", value: "3/3", expected: shardSpec{count: 3, index: 3}},
+		{name: "only shard", value: "1/1", expected: shardSpec{count: 1, index: 1}},
+		{name: "no slash", value: "1", expectedError: `shard must be of the form "i/n"`},
+		{name: "index not a number", value: "a/3", expectedError: `invalid shard index "a"`},
+		{name: "count not a number", value: "1/b", expectedError: `invalid shard count "b"`},
+		{name: "index 0", value: "0/3", expectedError: "shard index must be between 1 and 3"},
+		{name: "index past count", value: "4/3", expectedError: "shard index must be between 1 and 3"},
+		{name: "count 0", value: "1/0", expectedError: "shard index must be between 1 and 0"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec := shardSpec{}
+			err := spec.Set(testCase.value)
+			if testCase.expectedError != "" {
+				if err == nil || err.Error() != testCase.expectedError {
+					t.Errorf("expected error %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set(%q) failed: %s", testCase.value, err)
+			}
+			if spec != testCase.expected {
+				t.Errorf("expected %+v, got %+v", testCase.expected, spec)
+			}
+			if spec.String() != testCase.value {
+				t.Errorf("String(): expected %q, got %q", testCase.value, spec.String())
+			}
+		})
+	}
+}
+
+// Every EAD is in exactly one shard, and the zero value contains every EAD.
+func TestShardSpecContains(t *testing.T) {
+	testEADs := []string{}
+	for i := 0; i < 300; i++ {
+		testEADs = append(testEADs, fmt.Sprintf("repo_%d/ead_%d", i%7, i))
+	}
+
+	for _, count := range []int{1, 2, 3, 10} {
+		t.Run(fmt.Sprintf("%d shards", count), func(t *testing.T) {
+			shardSizes := make([]int, count)
+			for _, testEAD := range testEADs {
+				shards := []int{}
+				for index := 1; index <= count; index++ {
+					if (&shardSpec{count: count, index: index}).contains(testEAD) {
+						shards = append(shards, index)
+					}
+				}
+				if len(shards) != 1 {
+					t.Fatalf("expected %s to be in exactly one shard, got shards %v", testEAD, shards)
+				}
+				shardSizes[shards[0]-1]++
+			}
+
+			for index, size := range shardSizes {
+				if size == 0 {
+					t.Errorf("shard %d/%d is empty", index+1, count)
+				}
+			}
+		})
+	}
+
+	for _, testEAD := range testEADs {
+		if !(&shardSpec{}).contains(testEAD) {
+			t.Errorf("expected the zero shardSpec to contain %s", testEAD)
+		}
+	}
+}
+
+func TestMergeRunResults(t *testing.T) {
+	inputs := inputHashes{IndexerVersion: "test", MassageRules: "rules"}
+	otherInputs := inputHashes{IndexerVersion: "other", MassageRules: "rules"}
+
+	testCases := []struct {
+		name          string
+		shards        []runResults
+		expectedError string
+	}{
+		{
+			name: "complete",
+			shards: []runResults{
+				{Shard: "2/2", Results: []eadResult{{TestEAD: "a/2", Inputs: inputs}}},
+				{Shard: "1/2", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}, {TestEAD: "a/3", Inputs: inputs}}},
+			},
+		},
+		{
+			name: "missing shard",
+			shards: []runResults{
+				{Shard: "1/3", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+				{Shard: "3/3", Results: []eadResult{{TestEAD: "a/3", Inputs: inputs}}},
+			},
+			expectedError: "Missing output directories for shards: 2/3",
+		},
+		{
+			name: "duplicate shard",
+			shards: []runResults{
+				{Shard: "1/2", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+				{Shard: "1/2", Results: []eadResult{{TestEAD: "a/2", Inputs: inputs}}},
+			},
+			expectedError: "are both shard 1/2",
+		},
+		{
+			name: "mismatched shard count",
+			shards: []runResults{
+				{Shard: "1/2", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+				{Shard: "2/3", Results: []eadResult{{TestEAD: "a/2", Inputs: inputs}}},
+			},
+			expectedError: "is shard 2/3, but other shards are out of 2",
+		},
+		{
+			name: "mismatched inputs",
+			shards: []runResults{
+				{Shard: "1/2", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+				{Shard: "2/2", Results: []eadResult{{TestEAD: "a/2", Inputs: otherInputs}}},
+			},
+			expectedError: "Shard 2/2 was not run with the same indexer version",
+		},
+		{
+			name: "EAD in two shards",
+			shards: []runResults{
+				{Shard: "1/2", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+				{Shard: "2/2", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+			},
+			expectedError: `"a/1" was tested by more than one shard`,
+		},
+		{
+			name: "not sharded",
+			shards: []runResults{
+				{Shard: "", Results: []eadResult{{TestEAD: "a/1", Inputs: inputs}}},
+			},
+			expectedError: "is not the output of a sharded run",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			shardDirs := []string{}
+			for _, shardResults := range testCase.shards {
+				shardDir := t.TempDir()
+				shardDirs = append(shardDirs, shardDir)
+				writeTestRunResults(t, shardDir, shardResults)
+			}
+
+			mergedResults, err := mergeRunResults(shardDirs)
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Errorf("expected error containing %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeRunResults() failed: %s", err)
+			}
+
+			mergedTestEADs := []string{}
+			for _, result := range mergedResults.Results {
+				mergedTestEADs = append(mergedTestEADs, result.TestEAD)
+			}
+			expectedTestEADs := []string{"a/1", "a/2", "a/3"}
+			if !slices.Equal(mergedTestEADs, expectedTestEADs) {
+				t.Errorf("expected results for %q, got %q", expectedTestEADs, mergedTestEADs)
+			}
+		})
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	for _, file := range []string{"test/a/x-add.txt", "test/b/y-add.txt", ".gitkeep"} {
+		copyTestdataFile(t, filepath.Join("testdata", "eads", testdataEAD+".xml"), filepath.Join(srcDir, file))
+	}
+
+	err := copyTree(srcDir, destDir)
+	if err != nil {
+		t.Fatalf("copyTree() failed: %s", err)
+	}
+	for _, file := range []string{"test/a/x-add.txt", "test/b/y-add.txt"} {
+		if _, err = os.Stat(filepath.Join(destDir, file)); err != nil {
+			t.Errorf("expected %s to be copied: %s", file, err)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(destDir, ".gitkeep")); err == nil {
+		t.Errorf("expected .gitkeep not to be copied")
+	}
+
+	err = copyTree(filepath.Join(srcDir, "missing"), destDir)
+	if err != nil {
+		t.Errorf("expected a missing source dir to be skipped, got %s", err)
+	}
+
+	// A second shard with a file which is already in the merged tree.
+	otherSrcDir := t.TempDir()
+	copyTestdataFile(t, filepath.Join("testdata", "eads", testdataEAD+".xml"),
+		filepath.Join(otherSrcDir, "test/b/y-add.txt"))
+	err = copyTree(otherSrcDir, destDir)
+	expectedError := fmt.Sprintf(`"%s" is in the outputs of more than one shard`, filepath.Join("test", "b", "y-add.txt"))
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("expected error %q, got %v", expectedError, err)
+	}
+}
+
+func writeTestRunResults(t *testing.T, outputDir string, results runResults) {
+	t.Helper()
+
+	bytes, err := json.Marshal(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(runResultsFileForOutputDir(outputDir)), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(runResultsFileForOutputDir(outputDir), bytes, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const summaryFileName = "summary.json"
+
+// Values for the `-fail-on` flag, which decides the exit status of `run`,
+// `merge`, and `report`.  "any" means exit with a failure status if any EAD
+// failed or could not be tested, "errors" only if any EAD could not be tested,
+// and "never" means always exit with status 0.
+const (
+	failOnAny    = "any"
+	failOnErrors = "errors"
+	failOnNever  = "never"
+)
+
+var failOnValues = []string{failOnAny, failOnErrors, failOnNever}
+
+// Counts of the Solr add messages tested for a single EAD.  "matched" and
+// "mismatched" include the collection doc.
+type eadCounts struct {
+	ComponentsTested int `json:"components_tested"`
+	GoldenFileErrors int `json:"golden_file_errors"`
+	Matched          int `json:"matched"`
+	Mismatched       int `json:"mismatched"`
+	// Totals of the `diffStats` of the mismatches.
+	MismatchedLinesDeleted  int `json:"mismatched_lines_deleted"`
+	MismatchedLinesInserted int `json:"mismatched_lines_inserted"`
+	MissingComponents       int `json:"missing_components"`
+	MissingGoldens          int `json:"missing_goldens"`
+	// 0 or 1: see `testRequestSequence`.
+	SequenceMismatches int `json:"sequence_mismatches"`
+}
+
+// Totals for a run, computed from the results rather than tracked while
+// testing, so that `merge` and `report` can recompute them.  Execution errors
+// are the EADs which errored or timed out.
+type runSummary struct {
+	ComponentsTested int     `json:"components_tested"`
+	EADsErrored      int     `json:"eads_errored"`
+	EADsFailed       int     `json:"eads_failed"`
+	EADsPassed       int     `json:"eads_passed"`
+	EADsTested       int     `json:"eads_tested"`
+	EADsTimedOut     int     `json:"eads_timed_out"`
+	ElapsedSeconds   float64 `json:"elapsed_seconds"`
+	ExecutionErrors  int     `json:"execution_errors"`
+	GoldenFileErrors int     `json:"golden_file_errors"`
+	Matched          int     `json:"matched"`
+	Mismatched       int     `json:"mismatched"`
+	// Lines changed in the diffs of the mismatches.  See `diffStats`.
+	MismatchedLinesDeleted  int `json:"mismatched_lines_deleted"`
+	MismatchedLinesInserted int `json:"mismatched_lines_inserted"`
+	MissingComponents       int `json:"missing_components"`
+	MissingGoldens          int `json:"missing_goldens"`
+	// Overlay files which replaced golden files in the run.  Always listed, so
+	// that accepted corrections can't silently hide differences.
+	OverlaysUsed []goldenOverlay `json:"overlays_used"`
+	// Golden files which matched only because of relaxed comparison semantics.
+	// They are included in `Matched`.
+	RelaxedMatches int `json:"relaxed_matches"`
+	// EADs for which go-ead-indexer would send a different sequence of Solr
+	// update requests than the v1 indexer did.
+	SequenceMismatches int    `json:"sequence_mismatches"`
+	Shard              string `json:"shard,omitempty"`
+	// Golden fix files which no tested golden file used: see
+	// `getStaleGoldenFixes`.  They count as failures for `-fail-on any`.
+	StaleGoldenFixes []string `json:"stale_golden_fixes"`
+}
+
+// A line of the summary written by `writeSummary`.
+type summaryRow struct {
+	label string
+	value any
+}
+
+// The golden files for these components exist, but go-ead-indexer did not
+// generate the components.
+type missingComponentsError struct {
+	componentIDs []string
+	testEAD      string
+}
+
+func (e missingComponentsError) Error() string {
+	return fmt.Sprintf("`EAD.Components` for testEAD %s is missing the following component IDs:\n%s",
+		e.testEAD, strings.Join(e.componentIDs, "\n"))
+}
+
+// go-ead-indexer generated a Solr add message for which there is no golden
+// file.
+type missingGoldenError struct {
+	err error
+}
+
+func (e missingGoldenError) Error() string {
+	return e.err.Error()
+}
+
+func (e missingGoldenError) Unwrap() error {
+	return e.err
+}
+
+// The golden and actual values of a Solr add message do not match.
+type mismatchError struct {
+	err   error
+	stats diffStats
+}
+
+func (e mismatchError) Error() string {
+	return e.err.Error()
+}
+
+func (e mismatchError) Unwrap() error {
+	return e.err
+}
+
+func newMismatchError(stats diffStats, format string, a ...any) error {
+	return mismatchError{err: fmt.Errorf(format, a...), stats: stats}
+}
+
+func newMissingGoldenError(format string, a ...any) error {
+	return missingGoldenError{err: fmt.Errorf(format, a...)}
+}
+
+func getExitStatus(summary runSummary, failOn string) int {
+	switch failOn {
+	case failOnAny:
+		if summary.EADsFailed > 0 || summary.ExecutionErrors > 0 || len(summary.StaleGoldenFixes) > 0 {
+			return exitFailure
+		}
+	case failOnErrors:
+		if summary.ExecutionErrors > 0 {
+			return exitFailure
+		}
+	}
+
+	return exitOK
+}
+
+func summarize(results runResults) runSummary {
+	summary := runSummary{
+		EADsTested:       len(results.Results),
+		ElapsedSeconds:   results.ElapsedSeconds,
+		OverlaysUsed:     []goldenOverlay{},
+		Shard:            results.Shard,
+		StaleGoldenFixes: append([]string{}, results.StaleGoldenFixes...),
+	}
+
+	for _, result := range results.Results {
+		switch result.Status {
+		case statusErrored:
+			summary.EADsErrored++
+		case statusFailed:
+			summary.EADsFailed++
+		case statusPassed:
+			summary.EADsPassed++
+		case statusTimeout:
+			summary.EADsTimedOut++
+		}
+
+		summary.ComponentsTested += result.Counts.ComponentsTested
+		summary.GoldenFileErrors += result.Counts.GoldenFileErrors
+		summary.Matched += result.Counts.Matched
+		summary.Mismatched += result.Counts.Mismatched
+		summary.MismatchedLinesDeleted += result.Counts.MismatchedLinesDeleted
+		summary.MismatchedLinesInserted += result.Counts.MismatchedLinesInserted
+		summary.MissingComponents += result.Counts.MissingComponents
+		summary.MissingGoldens += result.Counts.MissingGoldens
+		summary.SequenceMismatches += result.Counts.SequenceMismatches
+		summary.OverlaysUsed = append(summary.OverlaysUsed, result.Overlays...)
+		summary.RelaxedMatches += len(result.RelaxedMatches)
+	}
+	summary.ExecutionErrors = summary.EADsErrored + summary.EADsTimedOut
+
+	return summary
+}
+
+func summaryFile() string {
+	return filepath.Join(outputDirPath, "tmp", summaryFileName)
+}
+
+func validateFailOn(failOn string) error {
+	if !slices.Contains(failOnValues, failOn) {
+		return fmt.Errorf(`Invalid fail on value "%s".  Valid values: %s`,
+			failOn, strings.Join(failOnValues, ", "))
+	}
+
+	return nil
+}
+
+// The values are aligned in a column after the longest label.
+func writeSummary(w io.Writer, summary runSummary) {
+	rows := []summaryRow{
+		{"EADs tested:", summary.EADsTested},
+		{"  passed:", summary.EADsPassed},
+		{"  failed:", summary.EADsFailed},
+		{"  errored:", summary.EADsErrored},
+		{"  timeout:", summary.EADsTimedOut},
+		{"Components tested:", summary.ComponentsTested},
+		{"Matched:", summary.Matched},
+		{"  relaxed:", summary.RelaxedMatches},
+		{"Mismatched:", summary.Mismatched},
+		{"  lines deleted:", summary.MismatchedLinesDeleted},
+		{"  lines inserted:", summary.MismatchedLinesInserted},
+		{"Missing goldens:", summary.MissingGoldens},
+		{"Missing components:", summary.MissingComponents},
+		{"Golden file errors:", summary.GoldenFileErrors},
+		{"Sequence mismatches:", summary.SequenceMismatches},
+		{"Execution errors:", summary.ExecutionErrors},
+		{"Overlays used:", len(summary.OverlaysUsed)},
+		{"Stale golden fixes:", len(summary.StaleGoldenFixes)},
+		{"Elapsed:", fmt.Sprintf("%.1fs", summary.ElapsedSeconds)},
+	}
+	labelWidth := 0
+	for _, row := range rows {
+		labelWidth = max(labelWidth, len(row.label))
+	}
+
+	report := strings.Builder{}
+	if summary.Shard != "" {
+		fmt.Fprintf(&report, "Shard %s\n", summary.Shard)
+	}
+	for _, row := range rows {
+		fmt.Fprintf(&report, "%-*s %v\n", labelWidth, row.label, row.value)
+		if row.label == "Overlays used:" {
+			for _, overlay := range summary.OverlaysUsed {
+				fmt.Fprintf(&report, "  %s: %s (%s)\n", overlay.File, overlay.Reason, overlay.Ticket)
+			}
+		}
+		if row.label == "Stale golden fixes:" {
+			for _, fixFile := range summary.StaleGoldenFixes {
+				fmt.Fprintf(&report, "  %s\n", fixFile)
+			}
+		}
+	}
+
+	fmt.Fprint(w, report.String())
+}
+
+func writeSummaryFile(summary runSummary) error {
+	bytes, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(summaryFile()), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(summaryFile(), bytes, 0644)
+}
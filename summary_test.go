@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	overlay := goldenOverlay{File: "test/tiny_001/tiny_001-add.txt", Reason: "fixed", Ticket: "DLFA-0"}
+	results := runResults{
+		ElapsedSeconds: 12.5,
+		Results: []eadResult{
+			{TestEAD: "a/1", Status: statusPassed, Counts: eadCounts{ComponentsTested: 3, Matched: 4},
+				Overlays: []goldenOverlay{overlay}, RelaxedMatches: map[string][]string{"1": {relaxationFieldOrder}}},
+			{TestEAD: "a/2", Status: statusFailed, Counts: eadCounts{ComponentsTested: 2, Matched: 1, Mismatched: 1,
+				MismatchedLinesDeleted: 2, MismatchedLinesInserted: 3, MissingComponents: 1, MissingGoldens: 1,
+				GoldenFileErrors: 1, SequenceMismatches: 1}},
+			{TestEAD: "a/3", Status: statusErrored},
+			{TestEAD: "a/4", Status: statusTimeout},
+		},
+		Shard:            "1/2",
+		StaleGoldenFixes: []string{"golden-fixes/tiny_001aspace_ref9.json"},
+	}
+
+	expected := runSummary{
+		ComponentsTested:        5,
+		EADsErrored:             1,
+		EADsFailed:              1,
+		EADsPassed:              1,
+		EADsTested:              4,
+		EADsTimedOut:            1,
+		ElapsedSeconds:          12.5,
+		ExecutionErrors:         2,
+		GoldenFileErrors:        1,
+		Matched:                 5,
+		Mismatched:              1,
+		MismatchedLinesDeleted:  2,
+		MismatchedLinesInserted: 3,
+		MissingComponents:       1,
+		MissingGoldens:          1,
+		OverlaysUsed:            []goldenOverlay{overlay},
+		RelaxedMatches:          1,
+		SequenceMismatches:      1,
+		Shard:                   "1/2",
+		StaleGoldenFixes:        []string{"golden-fixes/tiny_001aspace_ref9.json"},
+	}
+	summary := summarize(results)
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestGetExitStatus(t *testing.T) {
+	testCases := []struct {
+		name               string
+		summary            runSummary
+		failOn             string
+		expectedExitStatus int
+	}{
+		{name: "passed, any", summary: runSummary{EADsPassed: 2}, failOn: failOnAny, expectedExitStatus: exitOK},
+		{name: "failed, any", summary: runSummary{EADsFailed: 1}, failOn: failOnAny, expectedExitStatus: exitFailure},
+		{name: "errored, any", summary: runSummary{ExecutionErrors: 1}, failOn: failOnAny, expectedExitStatus: exitFailure},
+		{name: "passed, errors", summary: runSummary{EADsPassed: 2}, failOn: failOnErrors, expectedExitStatus: exitOK},
+		{name: "failed, errors", summary: runSummary{EADsFailed: 1}, failOn: failOnErrors, expectedExitStatus: exitOK},
+		{name: "errored, errors", summary: runSummary{ExecutionErrors: 1}, failOn: failOnErrors, expectedExitStatus: exitFailure},
+		{name: "passed, never", summary: runSummary{EADsPassed: 2}, failOn: failOnNever, expectedExitStatus: exitOK},
+		{name: "failed, never", summary: runSummary{EADsFailed: 1}, failOn: failOnNever, expectedExitStatus: exitOK},
+		{name: "errored, never", summary: runSummary{ExecutionErrors: 1}, failOn: failOnNever, expectedExitStatus: exitOK},
+		{name: "stale golden fix, any", summary: runSummary{EADsPassed: 2, StaleGoldenFixes: []string{"f"}}, failOn: failOnAny, expectedExitStatus: exitFailure},
+		{name: "stale golden fix, errors", summary: runSummary{EADsPassed: 2, StaleGoldenFixes: []string{"f"}}, failOn: failOnErrors, expectedExitStatus: exitOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			exitStatus := getExitStatus(testCase.summary, testCase.failOn)
+			if exitStatus != testCase.expectedExitStatus {
+				t.Errorf("expected exit status %d, got %d", testCase.expectedExitStatus, exitStatus)
+			}
+		})
+	}
+}
+
+func TestValidateFailOn(t *testing.T) {
+	for _, failOn := range failOnValues {
+		if err := validateFailOn(failOn); err != nil {
+			t.Errorf("expected %q to be valid, got %s", failOn, err)
+		}
+	}
+	if err := validateFailOn("all"); err == nil {
+		t.Errorf(`expected "all" to be invalid`)
+	}
+}
+
+// Every value starts in the same column.
+func TestWriteSummary(t *testing.T) {
+	summary := runSummary{
+		EADsTested:         1234,
+		OverlaysUsed:       []goldenOverlay{{File: "test/tiny_001/tiny_001-add.txt", Reason: "fixed", Ticket: "DLFA-0"}},
+		SequenceMismatches: 5,
+		Shard:              "1/2",
+	}
+	report := strings.Builder{}
+	writeSummary(&report, summary)
+
+	lines := strings.Split(strings.TrimSuffix(report.String(), "\n"), "\n")
+	if lines[0] != "Shard 1/2" {
+		t.Errorf(`expected first line "Shard 1/2", got %q`, lines[0])
+	}
+	expectedLines := map[string]string{
+		"EADs tested:":         "1234",
+		"Sequence mismatches:": "5",
+		"Overlays used:":       "1",
+		"Elapsed:":             "0.0s",
+	}
+	valueColumn := len("Sequence mismatches: ")
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "  test/") {
+			continue
+		}
+		if len(line) <= valueColumn || line[valueColumn-1] != ' ' || line[valueColumn] == ' ' {
+			t.Errorf("expected the value to start at column %d, got %q", valueColumn, line)
+			continue
+		}
+		label := strings.TrimSpace(line[:valueColumn])
+		if expectedValue, ok := expectedLines[label]; ok && line[valueColumn:] != expectedValue {
+			t.Errorf("%s: expected %q, got %q", label, expectedValue, line[valueColumn:])
+		}
+	}
+	expectedOverlayLine := fmt.Sprintf("  %s: fixed (DLFA-0)", summary.OverlaysUsed[0].File)
+	if !strings.Contains(report.String(), "Overlays used:       1\n"+expectedOverlayLine+"\n") {
+		t.Errorf("expected the overlay to be listed after the count, got %q", report.String())
+	}
+}
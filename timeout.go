@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A test of an EAD is abandoned when it times out.  There's no way to stop the
+// goroutine that is testing it -- `ead.New` can't be cancelled -- so it keeps
+// running in the background, and it must be prevented from writing any more
+// outputs for the EAD.  Every write of a diff, tmp actual, or crash file goes
+// through `guardedWrite`, which holds a read lock on the EAD's guard while
+// writing, so once `abandon` has taken the write lock and returned, no more
+// writes for the EAD can happen.
+type writeGuard struct {
+	abandoned bool
+	mutex     sync.RWMutex
+}
+
+var errAbandoned = errors.New("test was abandoned after timing out")
+
+// 0 means no timeout.
+var eadTimeout time.Duration
+
+var writeGuards sync.Map
+
+func abandon(testEAD string, cleanUp func()) {
+	guard := getWriteGuard(testEAD)
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	guard.abandoned = true
+	cleanUp()
+}
+
+func getGoroutineDump() string {
+	dump := strings.Builder{}
+	// debug=2 uses the same format as the dump for an unrecovered panic.
+	pprof.Lookup("goroutine").WriteTo(&dump, 2)
+
+	return dump.String()
+}
+
+func getWriteGuard(testEAD string) *writeGuard {
+	guard, _ := writeGuards.LoadOrStore(testEAD, &writeGuard{})
+
+	return guard.(*writeGuard)
+}
+
+func guardedWrite(testEAD string, write func() error) error {
+	guard := getWriteGuard(testEAD)
+	guard.mutex.RLock()
+	defer guard.mutex.RUnlock()
+
+	if guard.abandoned {
+		return errAbandoned
+	}
+
+	return write()
+}
+
+// If the test takes longer than `eadTimeout`, it is abandoned, any outputs it
+// wrote are removed, and a "timeout" result is returned with a crash file that
+// contains a dump of all goroutines -- the one testing the EAD will show where
+// it is stuck.
+func testSingleEADWithTimeout(testEAD string) *eadTestOutput {
+	if eadTimeout == 0 {
+		return testSingleEAD(testEAD)
+	}
+
+	startTime := time.Now()
+	done := make(chan *eadTestOutput, 1)
+	go func() {
+		done <- testSingleEAD(testEAD)
+	}()
+
+	timer := time.NewTimer(eadTimeout)
+	defer timer.Stop()
+
+	select {
+	case output := <-done:
+		return output
+	case <-timer.C:
+	}
+
+	elapsed := time.Since(startTime)
+	goroutineDump := getGoroutineDump()
+	message := fmt.Sprintf("timed out after %s (limit: %s)", elapsed.Round(time.Millisecond), eadTimeout)
+
+	output := newEADTestOutput(testEAD)
+	fmt.Fprintf(&output.stdout, "[ %s ] Testing %s\n", startTime.Format("2006-01-02 15:04:05"), testEAD)
+	output.logger.Println(fmt.Sprintf("TIMEOUT: %s %s", testEAD, message))
+	output.result.Error = message
+	output.result.Status = statusTimeout
+
+	abandon(testEAD, func() {
+		err := removeEADOutputs(testEAD)
+		if err != nil {
+			output.logger.Println(fmt.Sprintf(`removeEADOutputs("%s") failed: %s`, testEAD, err))
+		}
+
+		err = writeCrashFile(testEAD, message, []byte(goroutineDump))
+		if err != nil {
+			output.logger.Println(fmt.Sprintf(`writeCrashFile("%s") failed: %s`, testEAD, err))
+			return
+		}
+		output.result.CrashFile = relativeCrashFile(testEAD)
+	})
+
+	return output
+}
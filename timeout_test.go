@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The EAD is made slow by a massage rule which blocks forever, after writing a
+// tmp actual file, so that there is an output to clean up.  It never unblocks,
+// so the abandoned test can't touch the globals set up by later tests.
+func TestTestSingleEADWithTimeout(t *testing.T) {
+	testCases := []struct {
+		name           string
+		timeout        time.Duration
+		block          bool
+		expectedStatus string
+	}{
+		{name: "no timeout", timeout: 0, block: false, expectedStatus: statusPassed},
+		{name: "finishes in time", timeout: time.Minute, block: false, expectedStatus: statusPassed},
+		{name: "times out", timeout: 50 * time.Millisecond, block: true, expectedStatus: statusTimeout},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testEAD := setUpTestRun(t, 1)[0]
+			eadTimeout = testCase.timeout
+
+			blocked := false
+			enabledMassageRules = []massageRule{{
+				ID:   "slow",
+				Kind: massageKindBuiltin,
+				massage: func(golden string, fileID string) (string, int, error) {
+					if testCase.block && !blocked {
+						blocked = true
+						err := writeActualSolrXMLToTmp(testEAD, fileID, golden)
+						if err != nil {
+							return golden, 0, err
+						}
+						select {}
+					}
+					return golden, 0, nil
+				},
+			}}
+
+			output := testSingleEADWithTimeout(testEAD)
+			if output.result.Status != testCase.expectedStatus {
+				t.Fatalf("expected status %q, got %q: %s", testCase.expectedStatus, output.result.Status,
+					output.stderr.String())
+			}
+			if testCase.expectedStatus != statusTimeout {
+				return
+			}
+
+			if !strings.HasPrefix(output.result.Error, "timed out after ") {
+				t.Errorf(`expected error starting with "timed out after ", got %q`, output.result.Error)
+			}
+			if !strings.Contains(output.stderr.String(), "TIMEOUT: "+testEAD) {
+				t.Errorf("expected the timeout to be logged, got %q", output.stderr.String())
+			}
+			if !strings.Contains(output.stdout.String(), "] Testing "+testEAD) {
+				t.Errorf("expected the test to be reported in stdout, got %q", output.stdout.String())
+			}
+
+			// The dump shows where the abandoned test is stuck.
+			crashReport, err := os.ReadFile(crashFile(testEAD))
+			if err != nil {
+				t.Fatalf("reading crash file failed: %s", err)
+			}
+			for _, expected := range []string{"Error: timed out after ", "TestTestSingleEADWithTimeout"} {
+				if !strings.Contains(string(crashReport), expected) {
+					t.Errorf("expected crash file to contain %q", expected)
+				}
+			}
+
+			// The output written before the timeout was removed, and the
+			// abandoned test can't write any more.
+			if _, err = os.Stat(tmpFile(testEAD, parseEADID(testEAD))); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected the tmp actual file to be removed, got %v", err)
+			}
+			err = writeDiffFile(testEAD, parseEADID(testEAD), "late diff")
+			if !errors.Is(err, errAbandoned) {
+				t.Errorf("expected errAbandoned, got %v", err)
+			}
+		})
+	}
+}
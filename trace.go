@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const massageDiffFileSuffix = "-massage.txt"
+const massageRulesReportFileName = "massage-rules-report.json"
+
+// A massage rule which changed a golden value, and how many replacements it
+// made.
+type massageStep struct {
+	Replacements int    `json:"replacements"`
+	RuleID       string `json:"rule_id"`
+}
+
+// The massage rules which changed a golden value, in the order in which they
+// were applied.  Rules which made no replacements are left out.
+type massageTrace []massageStep
+
+// How much a massage rule was used in a run.  `Files` are the golden files it
+// changed, as [repository code]/[EAD ID]/[file ID].
+type massageRuleUsage struct {
+	Files        []string `json:"files"`
+	Replacements int      `json:"replacements"`
+	RuleID       string   `json:"rule_id"`
+}
+
+// Rules which never fired are candidates for retirement -- but note that a run
+// with filters only covers part of the corpus.
+type massageRulesReport struct {
+	NeverFired []string           `json:"never_fired"`
+	Rules      []massageRuleUsage `json:"rules"`
+}
+
+// Diffs the raw golden value against the massaged golden value one massage rule
+// at a time, so that each hunk is labeled by the rule which caused it.  Like the
+// diff files, the values are prettified before diffing.
+func getMassageDiff(testEAD string, fileID string, rawGolden string) (string, error) {
+	massageDiff := strings.Builder{}
+	fmt.Fprintf(&massageDiff, "Massage rules applied to the golden value for %s/%s\n", testEAD, fileID)
+
+	_, trace, err := massageGoldenVisitingSteps(rawGolden, parseRepositoryCode(testEAD), fileID,
+		func(rule massageRule, replacements int, before string, after string) {
+			fmt.Fprintf(&massageDiff, "\n### massage rule %s: %d replacements\n### %s (%s)\n",
+				rule.ID, replacements, rule.Description, rule.Jira)
+			diff := diffPrettified("golden before "+rule.ID, before, "golden after "+rule.ID, after)
+			if diff == "" {
+				diff = "(no difference after prettifying)\n"
+			}
+			massageDiff.WriteString(diff)
+		})
+	if err != nil {
+		return "", err
+	}
+	if len(trace) == 0 {
+		massageDiff.WriteString("\nNo massage rules changed the golden value.\n")
+	}
+
+	return massageDiff.String(), nil
+}
+
+func massageDiffFile(testEAD string, fileID string) string {
+	return filepath.Join(diffsDirPath, testEAD, fileID+massageDiffFileSuffix)
+}
+
+func massageRulesReportFile() string {
+	return filepath.Join(outputDirPath, "tmp", massageRulesReportFileName)
+}
+
+// The rules are reported in the order in which they were applied.
+func getMassageRulesReport(results runResults) massageRulesReport {
+	report := massageRulesReport{NeverFired: []string{}, Rules: []massageRuleUsage{}}
+	for _, ruleID := range results.MassageRules {
+		report.Rules = append(report.Rules, massageRuleUsage{Files: []string{}, RuleID: ruleID})
+	}
+
+	for _, result := range results.Results {
+		fileIDs := []string{}
+		for fileID := range result.MassageTraces {
+			fileIDs = append(fileIDs, fileID)
+		}
+		slices.Sort(fileIDs)
+
+		for _, fileID := range fileIDs {
+			for _, step := range result.MassageTraces[fileID] {
+				i := slices.IndexFunc(report.Rules, func(usage massageRuleUsage) bool {
+					return usage.RuleID == step.RuleID
+				})
+				if i < 0 {
+					continue
+				}
+				report.Rules[i].Files = append(report.Rules[i].Files, result.TestEAD+"/"+fileID)
+				report.Rules[i].Replacements += step.Replacements
+			}
+		}
+	}
+
+	for _, usage := range report.Rules {
+		if usage.Replacements == 0 {
+			report.NeverFired = append(report.NeverFired, usage.RuleID)
+		}
+	}
+
+	return report
+}
+
+func writeMassageRulesReport(w io.Writer, report massageRulesReport) {
+	text := strings.Builder{}
+	fmt.Fprintln(&text, "Massage rules:")
+	for _, usage := range report.Rules {
+		fmt.Fprintf(&text, "  %s: %d replacements in %d golden files\n",
+			usage.RuleID, usage.Replacements, len(usage.Files))
+	}
+	if len(report.NeverFired) > 0 {
+		fmt.Fprintf(&text, "  never fired: %s\n", strings.Join(report.NeverFired, ", "))
+	}
+
+	fmt.Fprint(w, text.String())
+}
+
+func writeMassageDiffFile(testEAD string, fileID string, massageDiff string) error {
+	return guardedWrite(testEAD, func() error {
+		massageDiffFile := massageDiffFile(testEAD, fileID)
+		err := os.MkdirAll(filepath.Dir(massageDiffFile), 0755)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(massageDiffFile, []byte(massageDiff), 0644)
+	})
+}
+
+func writeMassageRulesReportFile(report massageRulesReport) error {
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(massageRulesReportFile()), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(massageRulesReportFile(), bytes, 0644)
+}